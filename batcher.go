@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"fmt"
+	"time"
+)
+
+// BatchEventHandler 批量事件处理器，配合 Batcher 使用
+type BatchEventHandler[T any] interface {
+	// Flush 处理一个批次的事件，batch在返回后会被复用，需要保留时应复制
+	Flush(batch []T)
+}
+
+// Batcher 批量处理适配器，作为事件处理器使用，将事件攒成批次后交给 BatchEventHandler 处理。
+// 批次中的事件数量达到size，或者批次中第一个事件已等待linger时刷新批次；
+// 由于消费端会在linger到期时主动唤醒，即使之后一直没有新的事件，批次也会按时刷新，消费端退出时会刷新未满的批次。
+// Batcher只能用于一个Lockfree，并且只会被消费端的g调用；
+// 批次会在OnEvent返回后继续持有事件，因此不支持 WithEventFactory（位置上的对象会被复用）及 WithRetry，
+// Flush panic时会以 BatchError 再次panic，设置 WithExceptionHandler 时可以通过errors.As获取整个批次
+type Batcher[T any] struct {
+	hdl    BatchEventHandler[T]
+	size   int
+	linger time.Duration
+	batch  []T
+	first  time.Time // 批次中第一个事件的时间
+}
+
+// BatchError Flush panic时的错误，Batch为该批次的事件
+type BatchError[T any] struct {
+	Batch []T
+	Err   error // Flush panic的内容
+}
+
+func (e *BatchError[T]) Error() string {
+	return fmt.Sprintf("flush batch of %d events: %v", len(e.Batch), e.Err)
+}
+
+func (e *BatchError[T]) Unwrap() error {
+	return e.Err
+}
+
+// NewBatcher 创建批量处理适配器，size小于1时为1，linger小于等于0时只按照数量刷新（以及消费端退出时）
+func NewBatcher[T any](handler BatchEventHandler[T], size int, linger time.Duration) *Batcher[T] {
+	if size < 1 {
+		size = 1
+	}
+	return &Batcher[T]{
+		hdl:    handler,
+		size:   size,
+		linger: linger,
+		batch:  make([]T, 0, size),
+	}
+}
+
+func (b *Batcher[T]) OnEvent(v T) {
+	if len(b.batch) == 0 && b.linger > 0 {
+		b.first = time.Now()
+	}
+	b.batch = append(b.batch, v)
+	if len(b.batch) >= b.size {
+		b.flush()
+	}
+}
+
+func (b *Batcher[T]) deadline() (time.Time, bool) {
+	if len(b.batch) == 0 || b.linger <= 0 {
+		return time.Time{}, false
+	}
+	return b.first.Add(b.linger), true
+}
+
+func (b *Batcher[T]) expire() {
+	b.flush()
+}
+
+func (b *Batcher[T]) retain() {}
+
+// flush 刷新批次，Flush panic时批次同样会被清空，防止重复刷新，批次的事件通过 BatchError 交给异常处理
+func (b *Batcher[T]) flush() {
+	if len(b.batch) == 0 {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			batch := append([]T(nil), b.batch...)
+			b.reset()
+			panic(&BatchError[T]{Batch: batch, Err: panicError(r)})
+		}
+	}()
+	b.hdl.Flush(b.batch)
+	b.reset()
+}
+
+func (b *Batcher[T]) reset() {
+	var zero T
+	for i := range b.batch {
+		// 清理引用，防止对象无法被回收
+		b.batch[i] = zero
+	}
+	b.batch = b.batch[:0]
+}
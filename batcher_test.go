@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatcherSize(t *testing.T) {
+	h := newBatchEventHandler()
+	l, err := New[int](NewBatcher[int](h, 4, time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, l.Producer().Write(i))
+	}
+	assert.Eventually(t, func() bool {
+		batches := h.snapshot()
+		return len(batches) == 2
+	}, 5*time.Second, time.Millisecond)
+	batches := h.snapshot()
+	assert.Equal(t, [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}}, batches)
+}
+
+func TestBatcherLinger(t *testing.T) {
+	strategies := map[string]blockStrategy{
+		"chan":  NewChanBlockStrategy(),
+		"cond":  NewConditionBlockStrategy(),
+		"sleep": NewSleepBlockStrategy(time.Millisecond),
+	}
+	linger := 20 * time.Millisecond
+	for name, blocks := range strategies {
+		t.Run(name, func(t *testing.T) {
+			h := newBatchEventHandler()
+			l, err := New[int](NewBatcher[int](h, 100, linger), WithWaitStrategy(blocks))
+			assert.NoError(t, err)
+			assert.NoError(t, l.Start())
+			defer l.Close()
+
+			start := time.Now()
+			for i := 0; i < 3; i++ {
+				assert.NoError(t, l.Producer().Write(i))
+			}
+			// 之后没有新的事件，消费端需要在linger到期后主动刷新
+			assert.Eventually(t, func() bool {
+				batches := h.snapshot()
+				return len(batches) == 1
+			}, 5*time.Second, time.Millisecond)
+			batches, times := h.snapshot(), h.timestamps()
+			assert.Equal(t, [][]int{{0, 1, 2}}, batches)
+			assert.False(t, times[0].Before(start.Add(linger)))
+		})
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	h := newBatchEventHandler()
+	l, err := New[int](NewBatcher[int](h, 100, 0))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, l.Producer().Write(i))
+	}
+	time.Sleep(50 * time.Millisecond)
+	batches := h.snapshot()
+	assert.Empty(t, batches)
+
+	// 消费端退出时刷新未满的批次
+	assert.NoError(t, l.Close())
+	assert.Eventually(t, func() bool {
+		batches := h.snapshot()
+		return len(batches) == 1
+	}, 5*time.Second, time.Millisecond)
+	batches = h.snapshot()
+	assert.Equal(t, [][]int{{0, 1, 2}}, batches)
+}
+
+// flushFunc 函数形式的批量事件处理器
+type flushFunc func(batch []int)
+
+func (f flushFunc) Flush(batch []int) {
+	f(batch)
+}
+
+func TestBatcherFlushPanic(t *testing.T) {
+	h := newBatchEventHandler()
+	var failed bool
+	flusher := flushFunc(func(batch []int) {
+		if !failed {
+			failed = true
+			panic("flush failed")
+		}
+		h.Flush(batch)
+	})
+	exh := &recordExceptionHandler[int]{}
+	l, err := New[int](NewBatcher[int](flusher, 3, time.Hour), WithExceptionHandler[int](exh))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, l.Producer().Write(i))
+	}
+	assert.Eventually(t, func() bool {
+		batches := h.snapshot()
+		return len(batches) == 1
+	}, 5*time.Second, time.Millisecond)
+	// panic的批次整体交给异常处理器，之后的批次不受影响
+	batches := h.snapshot()
+	assert.Equal(t, [][]int{{3, 4, 5}}, batches)
+	assert.Equal(t, 1, exh.len())
+	var be *BatchError[int]
+	assert.ErrorAs(t, exh.errs[0], &be)
+	assert.Equal(t, []int{0, 1, 2}, be.Batch)
+}
+
+func TestBatcherLingerForwarded(t *testing.T) {
+	linger := 20 * time.Millisecond
+	// 包装在 JournalHandler 中
+	h := newBatchEventHandler()
+	journal, err := NewJournalHandler[int](NewBatcher[int](h, 100, linger), JSONCodec[int]{},
+		JournalConfig[int]{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	l, err := New[int](journal)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, l.Producer().Write(i))
+	}
+	assert.Eventually(t, func() bool {
+		batches := h.snapshot()
+		return len(batches) == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.NoError(t, l.Close())
+	assert.NoError(t, journal.Close())
+
+	// 作为 Coalescing 的事件处理器
+	h = newBatchEventHandler()
+	c, err := NewCoalescing[int, int](NewBatcher[int](h, 100, linger))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Start())
+	defer c.Close()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Write(i, i))
+	}
+	assert.Eventually(t, func() bool {
+		batches := h.snapshot()
+		return len(batches) == 1
+	}, 5*time.Second, time.Millisecond)
+	batches := h.snapshot()
+	assert.Equal(t, [][]int{{0, 1, 2}}, batches)
+}
+
+func TestBatcherInvalidOptions(t *testing.T) {
+	b := NewBatcher[int](newBatchEventHandler(), 10, 0)
+	factory := WithEventFactory[int](func() int { return 0 })
+	retry := WithRetry(RetryPolicy{MaxAttempts: 2})
+	// 批次持有事件，位置上的对象不能被复用，也不能重试
+	for _, opt := range []Option{factory, retry} {
+		_, err := New[int](b, opt)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	}
+	journal, err := NewJournalHandler[int](b, JSONCodec[int]{}, JournalConfig[int]{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	_, err = New[int](journal, factory)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	// Bus的订阅者可能被并发调用
+	bus, err := NewBus[int](1)
+	assert.NoError(t, err)
+	_, err = bus.Subscribe("orders", b)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
@@ -16,7 +16,7 @@ import (
 
 // blockStrategy 阻塞策略
 type blockStrategy interface {
-	// block 阻塞
+	// block 阻塞，当actual达到expected时表示条件已满足，无需阻塞
 	block(actual *uint64, expected uint64)
 
 	// release 释放阻塞
@@ -107,7 +107,7 @@ func (s *ChanBlockStrategy) block(actual *uint64, expected uint64) {
 	// 0：未阻塞；1：阻塞
 	if atomic.CompareAndSwapUint32(&s.b, 0, 1) {
 		// 设置成功的话，表示阻塞，需要进行二次判断
-		if atomic.LoadUint64(actual) == expected {
+		if atomic.LoadUint64(actual) >= expected {
 			// 表示阻塞失败，因为结果是一致的，此处需要重新将状态调整回来
 			if atomic.CompareAndSwapUint32(&s.b, 1, 0) {
 				// 表示回调成功，直接退出即可
@@ -147,7 +147,7 @@ func NewConditionBlockStrategy() *ConditionBlockStrategy {
 func (s *ConditionBlockStrategy) block(actual *uint64, expected uint64) {
 	s.cond.L.Lock()
 	defer s.cond.L.Unlock()
-	if atomic.LoadUint64(actual) == expected {
+	if atomic.LoadUint64(actual) >= expected {
 		return
 	}
 	s.cond.Wait()
@@ -158,3 +158,102 @@ func (s *ConditionBlockStrategy) release() {
 	defer s.cond.L.Unlock()
 	s.cond.Broadcast()
 }
+
+// sharedBlockStrategy 多等待者阻塞策略，基于用户传入的阻塞策略创建，用于可能有多个g同时等待的场景（如buffer写满时的生产者）
+// 对于chan和condition这类会挂起g的策略，由于chan策略仅支持单个等待者，统一使用condition实现，
+// 同时维护等待者数量，仅在存在等待者时才会加锁唤醒，避免影响释放方的性能；
+// 对于调度、休眠、空指令等不挂起g的策略，直接按照用户传入的策略等待
+type sharedBlockStrategy struct {
+	cond    *sync.Cond
+	blocks  blockStrategy // 用户传入的策略，cond为nil时使用
+	ready   func() bool   // 额外的等待条件，返回true时表示无需阻塞
+	waiters int32
+	closed  bool
+}
+
+func newSharedBlockStrategy(blocks blockStrategy) *sharedBlockStrategy {
+	switch blocks.(type) {
+	case *ChanBlockStrategy, *ConditionBlockStrategy:
+		return &sharedBlockStrategy{
+			cond: sync.NewCond(&sync.Mutex{}),
+		}
+	}
+	return &sharedBlockStrategy{
+		blocks: blocks,
+	}
+}
+
+// newReadyBlockStrategy 创建带有额外等待条件的阻塞策略，用于消费端除buffer外还需要等待其他条件的场景（如溢出文件）
+// 对于chan和condition策略，使用带等待条件的condition实现，条件的修改方需要在修改后调用release；
+// 对于不挂起g的策略，阻塞后会很快返回并重新判断，直接使用原策略即可
+func newReadyBlockStrategy(blocks blockStrategy, ready func() bool) blockStrategy {
+	switch blocks.(type) {
+	case *ChanBlockStrategy, *ConditionBlockStrategy:
+		return &sharedBlockStrategy{
+			cond:  sync.NewCond(&sync.Mutex{}),
+			ready: ready,
+		}
+	}
+	return blocks
+}
+
+func (s *sharedBlockStrategy) block(actual *uint64, expected uint64) {
+	s.blockUntil(actual, expected, time.Time{})
+}
+
+// blockUntil 与block一致，deadline不为零值时最多阻塞到deadline
+func (s *sharedBlockStrategy) blockUntil(actual *uint64, expected uint64, deadline time.Time) {
+	if s.cond == nil {
+		s.blocks.block(actual, expected)
+		return
+	}
+	if !deadline.IsZero() {
+		// 定时器在加锁后唤醒，等待前在锁内判断是否已超时，因此不会错过唤醒
+		timer := time.AfterFunc(time.Until(deadline), func() {
+			s.cond.L.Lock()
+			defer s.cond.L.Unlock()
+			s.cond.Broadcast()
+		})
+		defer timer.Stop()
+	}
+	// 先增加等待者数量再判断条件，与release中先修改条件再判断等待者数量相对应，防止丢失唤醒
+	atomic.AddInt32(&s.waiters, 1)
+	s.cond.L.Lock()
+	// ready可能会修改actual（如刷新读取游标），因此需要先判断ready
+	if !s.closed && (s.ready == nil || !s.ready()) && atomic.LoadUint64(actual) < expected &&
+		(deadline.IsZero() || time.Now().Before(deadline)) {
+		s.cond.Wait()
+	}
+	s.cond.L.Unlock()
+	atomic.AddInt32(&s.waiters, -1)
+}
+
+func (s *sharedBlockStrategy) release() {
+	if s.cond == nil || atomic.LoadInt32(&s.waiters) == 0 {
+		return
+	}
+	s.cond.L.Lock()
+	defer s.cond.L.Unlock()
+	s.cond.Broadcast()
+}
+
+// open 开启阻塞，与close对应，用于重新启动的场景
+func (s *sharedBlockStrategy) open() {
+	if s.cond == nil {
+		return
+	}
+	s.cond.L.Lock()
+	defer s.cond.L.Unlock()
+	s.closed = false
+}
+
+// close 关闭阻塞，释放所有的等待者，并且关闭后不会再阻塞
+func (s *sharedBlockStrategy) close() {
+	if s.cond == nil {
+		return
+	}
+	s.cond.L.Lock()
+	defer s.cond.L.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+}
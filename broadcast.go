@@ -0,0 +1,267 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Broadcast 广播，每个事件都会投递给所有的订阅者，订阅者之间互不影响，各自维护读取游标并按照自己的速度处理，
+// 生产者由最慢的订阅者限制，即buffer中所有订阅者均已读取的位置才可以被覆盖写入。
+// 订阅者可以在运行时通过 Subscribe 和 Unsubscribe 动态增减，新的订阅者从订阅时的写入游标之后开始读取，
+// 没有订阅者时写入的事件会被直接丢弃
+type Broadcast[T any] struct {
+	name    string
+	o       *options
+	seqer   *sequencer // rc为所有订阅者读取游标的最小值，由生产者在buffer写满时刷新
+	rbuf    *ringBuffer[T]
+	writer  *Producer[T]
+	pblocks *sharedBlockStrategy
+	exh     ExceptionHandler[T]
+	mu      sync.Mutex   // 保护订阅者的增减
+	subs    atomic.Value // []*subscription[T]，写时复制
+	status  int32
+}
+
+// Subscription 订阅，由 Broadcast.Subscribe 返回
+type Subscription interface {
+	// Unsubscribe 取消订阅，之后不会再收到新的事件，会等待正在处理的事件处理完成后返回，
+	// 因此不能在该订阅者自身的事件处理器中调用
+	Unsubscribe() error
+}
+
+// subscription 订阅者，复用消费者的读取逻辑，每个订阅者拥有独立的读取游标
+type subscription[T any] struct {
+	b      *Broadcast[T]
+	seqer  *sequencer // 与广播共享写入游标
+	cmer   *consumer[T]
+	blocks blockStrategy
+}
+
+// NewBroadcast 通过配置项创建广播，配置项参考 New，不支持 WithEventFactory 和 WithSpill
+func NewBroadcast[T any](opts ...Option) (*Broadcast[T], error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.factory != nil || o.spill != nil {
+		return nil, configError("event factory and spill are not supported by broadcast")
+	}
+	if o.stall != nil || o.watermarks != nil {
+		return nil, configError("stall watchdog and watermarks are not supported by broadcast")
+	}
+	if o.weights != nil {
+		return nil, configError("lane weights are only supported by priority lockfree")
+	}
+	if err := checkBaseOptions[T](o); err != nil {
+		return nil, err
+	}
+	o.capacity, _ = NextPowerOfTwo(o.capacity)
+	b := &Broadcast[T]{
+		name:   o.name,
+		o:      o,
+		seqer:  newSequencer(o.capacity),
+		rbuf:   newRingBuffer[T](o.capacity),
+		status: READY,
+	}
+	b.exh, _ = o.exception.(ExceptionHandler[T])
+	b.subs.Store([]*subscription[T]{})
+	// 生产者阻塞前刷新读取游标，订阅者推进读取游标后只负责唤醒，保证不会丢失唤醒
+	b.pblocks = newSharedBlockStrategy(o.blocks)
+	b.pblocks.ready = func() bool {
+		b.gate()
+		return false
+	}
+	b.writer = newProducer[T](b.seqer, b.rbuf, subscriberBlocks[T]{b}, b.pblocks, o.producerType == ProducerSingle)
+	b.writer.name = b.name
+	b.writer.gate = b.gate
+	return b, nil
+}
+
+// Subscribe 增加订阅者，从当前写入游标之后的事件开始处理，已写入但尚未处理的事件不会投递给该订阅者
+// 广播运行中时订阅者会立即启动，否则在 Start 时启动
+func (b *Broadcast[T]) Subscribe(handler EventHandler[T]) (Subscription, error) {
+	if err := checkHandler[T](handler, b.o); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// 加入订阅者列表前读取游标不能大于共享的读取游标，防止gate据此推进共享的读取游标
+	seqer := &sequencer{
+		wc:       b.seqer.wc,
+		rc:       atomic.LoadUint64(&b.seqer.rc),
+		capacity: b.seqer.capacity,
+	}
+	sub := &subscription[T]{b: b, seqer: seqer}
+	wake := &alarm{}
+	// 订阅者各自阻塞，关闭时只需唤醒自身
+	sub.blocks = newReadyBlockStrategy(b.o.blocks, func() bool {
+		return wake.ready() || sub.cmer.closed()
+	})
+	wake.release = sub.blocks.release
+	sub.cmer = newConsumer[T](b.rbuf, handler, seqer, sub.blocks, b.pblocks, false, b.exh)
+	sub.cmer.wake = wake
+	sub.cmer.retry = b.o.retry
+	sub.cmer.limiter = newTokenBucket(b.o.rateLimit)
+	sub.cmer.dead, _ = b.o.deadLetter.(deadLetterFunc[T])
+	old := b.loadSubs()
+	subs := make([]*subscription[T], 0, len(old)+1)
+	subs = append(append(subs, old...), sub)
+	b.subs.Store(subs)
+	// 加入订阅者列表后再获取写入游标，与gate中先获取写入游标再获取订阅者相对应，
+	// 保证gate推进的读取游标不会超过该订阅者的读取游标
+	atomic.StoreUint64(&seqer.rc, b.seqer.wc.atomicLoad()+1)
+	if b.Running() {
+		if err := sub.cmer.start(); err != nil {
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+// Unsubscribe 取消订阅，与 Subscription.Unsubscribe 一致
+func (b *Broadcast[T]) Unsubscribe(sub Subscription) error {
+	if s, ok := sub.(*subscription[T]); !ok || s.b != b {
+		return unsubscribeError(b.name, ErrInvalidSubscription)
+	}
+	return sub.Unsubscribe()
+}
+
+func (s *subscription[T]) Unsubscribe() error {
+	b := s.b
+	b.mu.Lock()
+	if !b.subscribed(s) {
+		b.mu.Unlock()
+		return closeError("Subscription")
+	}
+	if !s.cmer.closed() {
+		if err := s.cmer.close(); err != nil {
+			b.mu.Unlock()
+			return err
+		}
+	}
+	b.mu.Unlock()
+	// 等待订阅者的g退出后再移除，否则生产者不再受其读取游标的限制，可能覆盖其正在读取的位置
+	s.cmer.wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := b.loadSubs()
+	subs := make([]*subscription[T], 0, len(old))
+	for _, x := range old {
+		if x != s {
+			subs = append(subs, x)
+		}
+	}
+	if len(subs) == len(old) {
+		return closeError("Subscription")
+	}
+	b.subs.Store(subs)
+	// 该订阅者可能是最慢的订阅者，释放因其阻塞的生产者
+	b.gate()
+	b.pblocks.release()
+	return nil
+}
+
+// gate 刷新读取游标为所有订阅者读取游标的最小值，没有订阅者时为当前写入游标之后的位置
+func (b *Broadcast[T]) gate() {
+	// 先获取写入游标再获取订阅者，保证之后订阅的订阅者的读取游标不会小于该值
+	min := b.seqer.wc.atomicLoad() + 1
+	for _, s := range b.loadSubs() {
+		if rc := s.seqer.nextRead(); rc < min {
+			min = rc
+		}
+	}
+	// 读取游标只增不减
+	for {
+		rc := atomic.LoadUint64(&b.seqer.rc)
+		if min <= rc || atomic.CompareAndSwapUint64(&b.seqer.rc, rc, min) {
+			return
+		}
+	}
+}
+
+// subscribed 订阅者是否仍在订阅中
+func (b *Broadcast[T]) subscribed(s *subscription[T]) bool {
+	for _, x := range b.loadSubs() {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Broadcast[T]) loadSubs() []*subscription[T] {
+	return b.subs.Load().([]*subscription[T])
+}
+
+// Subscribers 当前订阅者数量
+func (b *Broadcast[T]) Subscribers() int {
+	return len(b.loadSubs())
+}
+
+func (b *Broadcast[T]) Start() error {
+	if atomic.CompareAndSwapInt32(&b.status, READY, RUNNING) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, s := range b.loadSubs() {
+			if err := s.cmer.start(); err != nil {
+				atomic.CompareAndSwapInt32(&b.status, RUNNING, READY)
+				return err
+			}
+		}
+		if err := b.writer.start(); err != nil {
+			atomic.CompareAndSwapInt32(&b.status, RUNNING, READY)
+			return err
+		}
+		return nil
+	}
+	return startError(b.name)
+}
+
+func (b *Broadcast[T]) Producer() *Producer[T] {
+	return b.writer
+}
+
+func (b *Broadcast[T]) Running() bool {
+	return atomic.LoadInt32(&b.status) == RUNNING
+}
+
+func (b *Broadcast[T]) Close() error {
+	if atomic.CompareAndSwapInt32(&b.status, RUNNING, READY) {
+		if err := b.writer.close(); err != nil {
+			atomic.CompareAndSwapInt32(&b.status, READY, RUNNING)
+			return err
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, s := range b.loadSubs() {
+			if err := s.cmer.close(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return closeError(b.name)
+}
+
+// subscriberBlocks 生产者写入后唤醒所有订阅者
+type subscriberBlocks[T any] struct {
+	b *Broadcast[T]
+}
+
+func (s subscriberBlocks[T]) block(actual *uint64, expected uint64) {
+	runtime.Gosched()
+}
+
+func (s subscriberBlocks[T]) release() {
+	for _, sub := range s.b.loadSubs() {
+		sub.blocks.release()
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcast(t *testing.T) {
+	for _, blocks := range []blockStrategy{NewChanBlockStrategy(), NewConditionBlockStrategy(), NewOSYieldWaitStrategy()} {
+		b, err := NewBroadcast[int](WithCapacity(8), WithWaitStrategy(blocks))
+		assert.NoError(t, err)
+		assert.NoError(t, b.Start())
+		// 没有订阅者时写入不会阻塞
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, b.Producer().Write(-1))
+		}
+		handlers := []*collectEventHandler[int]{{}, {}, {}}
+		for _, h := range handlers {
+			_, err = b.Subscribe(h)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 3, b.Subscribers())
+		var (
+			goS   = 4
+			perGo = 500
+			wg    sync.WaitGroup
+		)
+		for g := 0; g < goS; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < perGo; i++ {
+					assert.NoError(t, b.Producer().Write(g*perGo+i))
+				}
+			}(g)
+		}
+		wg.Wait()
+		for _, h := range handlers {
+			h := h
+			assert.Eventually(t, func() bool { return len(h.snapshot()) == goS*perGo }, 5*time.Second, time.Millisecond)
+		}
+		// 所有订阅者收到相同顺序的事件
+		expected := handlers[0].snapshot()
+		for _, h := range handlers[1:] {
+			assert.Equal(t, expected, h.snapshot())
+		}
+		assert.NoError(t, b.Close())
+	}
+}
+
+func TestBroadcastSubscribe(t *testing.T) {
+	b, err := NewBroadcast[int](WithCapacity(4))
+	assert.NoError(t, err)
+	assert.NoError(t, b.Start())
+	fast := &collectEventHandler[int]{}
+	_, err = b.Subscribe(fast)
+	assert.NoError(t, err)
+	// 慢订阅者限制生产者
+	slow := newGateEventHandler[int]()
+	slowSub, err := b.Subscribe(slow)
+	assert.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 20; i++ {
+			assert.NoError(t, b.Producer().Write(i))
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatal("producer should be gated by the slow subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 取消订阅等待慢订阅者正在处理的事件完成
+	unsubscribed := make(chan error, 1)
+	go func() {
+		unsubscribed <- b.Unsubscribe(slowSub)
+	}()
+	select {
+	case <-unsubscribed:
+		t.Fatal("unsubscribe should wait for the in-flight event")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(slow.gate)
+	assert.NoError(t, <-unsubscribed)
+	assert.Error(t, slowSub.Unsubscribe())
+	// 取消慢订阅者后生产者继续写入
+	<-done
+	assert.Eventually(t, func() bool { return len(fast.snapshot()) == 20 }, time.Second, time.Millisecond)
+
+	// 新的订阅者从订阅时的写入游标之后开始
+	late := &collectEventHandler[int]{}
+	_, err = b.Subscribe(late)
+	assert.NoError(t, err)
+	for i := 21; i <= 30; i++ {
+		assert.NoError(t, b.Producer().Write(i))
+	}
+	assert.Eventually(t, func() bool { return len(late.snapshot()) == 10 }, time.Second, time.Millisecond)
+	assert.Equal(t, []int{21, 22, 23, 24, 25, 26, 27, 28, 29, 30}, late.snapshot())
+	assert.Len(t, fast.snapshot(), 30)
+	assert.NoError(t, b.Close())
+
+	other, _ := NewBroadcast[int]()
+	err = other.Unsubscribe(slowSub)
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+	var qe *QueueError
+	assert.ErrorAs(t, err, &qe)
+	assert.Equal(t, "unsubscribe", qe.Op)
+	_, err = b.Subscribe(nil)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = NewBroadcast[int](WithEventFactory[int](func() int { return 0 }))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestBroadcastUnsubscribeChurn(t *testing.T) {
+	b, err := NewBroadcast[int](WithCapacity(4))
+	assert.NoError(t, err)
+	assert.NoError(t, b.Start())
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			assert.NoError(t, b.Producer().Write(i))
+		}
+	}()
+	// 订阅者频繁增减时，取消订阅返回后订阅者不再处理事件
+	for i := 0; i < 200; i++ {
+		h := &countEventHandler[int]{}
+		sub, err := b.Subscribe(h)
+		assert.NoError(t, err)
+		runtime.Gosched()
+		assert.NoError(t, sub.Unsubscribe())
+		n := h.load()
+		runtime.Gosched()
+		assert.Equal(t, n, h.load())
+	}
+	close(stop)
+	<-done
+	assert.Equal(t, 0, b.Subscribers())
+	assert.NoError(t, b.Close())
+}
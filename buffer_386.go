@@ -36,6 +36,13 @@ func newRingBuffer[T any](cap int) *ringBuffer[T] {
 	return &x
 }
 
+// fill 使用事件工厂填充每个位置，仅在创建时调用
+func (r *ringBuffer[T]) fill(factory EventFactory[T]) {
+	for i := range r.buf {
+		r.buf[i].val = factory()
+	}
+}
+
 func (r *ringBuffer[T]) write(c uint64, v T) {
 	x := &r.buf[c&r.capMask]
 	r.Lock()
@@ -44,6 +51,19 @@ func (r *ringBuffer[T]) write(c uint64, v T) {
 	x.c = c + 1
 }
 
+// slot 获取指定位置对象的指针，用于直接在buffer中填充对象，填充完成后需要调用publish
+func (r *ringBuffer[T]) slot(c uint64) *T {
+	return &r.buf[c&r.capMask].val
+}
+
+// publish 发布指定位置，表示该位置的对象已填充完成，可以被读取
+func (r *ringBuffer[T]) publish(c uint64) {
+	x := &r.buf[c&r.capMask]
+	r.Lock()
+	defer r.Unlock()
+	x.c = c + 1
+}
+
 func (r *ringBuffer[T]) element(c uint64) e[T] {
 	return r.buf[c&r.capMask]
 }
@@ -62,3 +82,37 @@ func (r *ringBuffer[T]) contains(c uint64) (T, *uint64, bool) {
 func (r *ringBuffer[T]) cap() uint64 {
 	return r.capMask + 1
 }
+
+// initSequence 将每个位置的序号初始化为其下标，用于 Queue
+func (r *ringBuffer[T]) initSequence() {
+	for i := range r.buf {
+		r.buf[i].c = uint64(i)
+	}
+}
+
+// sequence 获取指定位置的序号，用于 Queue
+func (r *ringBuffer[T]) sequence(c uint64) uint64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.buf[c&r.capMask].c
+}
+
+// put 将对象写入指定位置并设置序号，用于 Queue
+func (r *ringBuffer[T]) put(c uint64, v T, seq uint64) {
+	x := &r.buf[c&r.capMask]
+	r.Lock()
+	defer r.Unlock()
+	x.val = v
+	x.c = seq
+}
+
+// take 取出指定位置的对象并设置序号，取出后该位置不再引用该对象，用于 Queue
+func (r *ringBuffer[T]) take(c uint64, seq uint64) T {
+	x := &r.buf[c&r.capMask]
+	r.Lock()
+	defer r.Unlock()
+	v := x.val
+	x.val = r.tDefault
+	x.c = seq
+	return v
+}
@@ -0,0 +1,372 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	topicSeparator = "."
+	topicWildcard  = "*"  // 匹配一个层级
+	topicTail      = ">"  // 匹配之后的所有层级（至少一个），只能位于最后
+	busCacheSize   = 4096 // 消费端匹配缓存的主题数量上限
+)
+
+// TopicEventHandler 带有主题的事件处理器，Bus的订阅者实现该接口时会收到事件的主题
+type TopicEventHandler[T any] interface {
+	OnTopicEvent(topic string, t T)
+}
+
+// TopicStats 主题统计
+type TopicStats struct {
+	Published uint64 // 发布的事件数量
+	Delivered uint64 // 投递给订阅者的次数，一个事件匹配多个订阅者时会计算多次
+	Unmatched uint64 // 没有匹配到任何订阅者的事件数量
+}
+
+// Bus 基于主题的发布订阅，主题由"."分隔为多个层级，如"orders.created"，
+// 订阅时可以使用通配符："*"匹配一个层级，">"匹配之后的所有层级（只能位于最后），如"orders.*"、"orders.>"。
+// 事件按照主题的hash写入到其中一个Lockfree中，因此同一主题的事件按照发布顺序处理，不同主题的事件可能并行处理；
+// 同一个订阅者可能会被多个Lockfree的消费端并发调用
+type Bus[T any] struct {
+	name    string
+	shards  []*Lockfree[busEvent[T]]
+	exh     ExceptionHandler[T]
+	mu      sync.Mutex   // 保护订阅者的增减
+	subs    atomic.Value // []*busSubscription[T]，写时复制
+	version uint64       // 订阅者变化时递增，用于刷新消费端的匹配缓存
+	stats   sync.Map     // topic -> *topicStats
+	status  int32
+}
+
+type busEvent[T any] struct {
+	topic string
+	v     T
+}
+
+type topicStats struct {
+	published uint64
+	delivered uint64
+	unmatched uint64
+}
+
+// busSubscription 主题订阅者
+type busSubscription[T any] struct {
+	bus     *Bus[T]
+	pattern []string
+	hdl     EventHandler[T]
+	thdl    TopicEventHandler[T]
+}
+
+// NewBus 创建由shards个Lockfree组成的Bus，shards小于1时为1，配置项应用于每个Lockfree，参考 New；
+// 不支持 WithEventFactory、WithSpill、WithRetry 及死信，设置 WithExceptionHandler 时订阅者的panic会交由异常处理器处理
+func NewBus[T any](shards int, opts ...Option) (*Bus[T], error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.factory != nil || o.spill != nil || o.retry != nil || o.deadLetter != nil || o.stall != nil || o.watermarks != nil {
+		return nil, configError("event factory, spill, retry, dead letter, stall watchdog and watermarks are not supported by bus")
+	}
+	if o.weights != nil {
+		return nil, configError("lane weights are only supported by priority lockfree")
+	}
+	if err := checkBaseOptions[T](o); err != nil {
+		return nil, err
+	}
+	o.capacity, _ = NextPowerOfTwo(o.capacity)
+	if shards < 1 {
+		shards = 1
+	}
+	b := &Bus[T]{
+		name:   o.name,
+		shards: make([]*Lockfree[busEvent[T]], shards),
+		status: READY,
+	}
+	b.exh, _ = o.exception.(ExceptionHandler[T])
+	b.subs.Store([]*busSubscription[T]{})
+	for i := range b.shards {
+		so := *o
+		so.name = fmt.Sprintf("%s-%d", o.name, i)
+		so.exception = nil
+		b.shards[i] = newLockfree[busEvent[T]](&busHandler[T]{bus: b}, &so, nil)
+	}
+	return b, nil
+}
+
+// Subscribe 订阅匹配pattern的主题，handler实现了 TopicEventHandler 时调用 OnTopicEvent，否则调用 OnEvent；
+// 订阅者可能被多个消费端并发调用，因此不支持只能由一个消费端调用的 Batcher
+func (b *Bus[T]) Subscribe(pattern string, handler EventHandler[T]) (Subscription, error) {
+	if handler == nil {
+		return nil, configError("event handler is nil")
+	}
+	if _, ok := handler.(deadlineHandler); ok {
+		return nil, configError("handler %T is not supported by bus", handler)
+	}
+	tokens, err := splitTopic(pattern, true)
+	if err != nil {
+		return nil, err
+	}
+	sub := &busSubscription[T]{
+		bus:     b,
+		pattern: tokens,
+		hdl:     handler,
+	}
+	sub.thdl, _ = handler.(TopicEventHandler[T])
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := b.loadSubs()
+	subs := make([]*busSubscription[T], 0, len(old)+1)
+	b.subs.Store(append(append(subs, old...), sub))
+	atomic.AddUint64(&b.version, 1)
+	return sub, nil
+}
+
+// Unsubscribe 取消订阅，与 Subscription.Unsubscribe 一致
+func (b *Bus[T]) Unsubscribe(sub Subscription) error {
+	if s, ok := sub.(*busSubscription[T]); !ok || s.bus != b {
+		return unsubscribeError(b.name, ErrInvalidSubscription)
+	}
+	return sub.Unsubscribe()
+}
+
+func (s *busSubscription[T]) Unsubscribe() error {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := b.loadSubs()
+	subs := make([]*busSubscription[T], 0, len(old))
+	for _, x := range old {
+		if x != s {
+			subs = append(subs, x)
+		}
+	}
+	if len(subs) == len(old) {
+		return closeError("Subscription")
+	}
+	b.subs.Store(subs)
+	atomic.AddUint64(&b.version, 1)
+	// 删除不再被任何订阅者匹配的主题的统计，防止统计随订阅者的增减无限增长
+	b.stats.Range(func(k, _ any) bool {
+		tokens := strings.Split(k.(string), topicSeparator)
+		if matchTopic(s.pattern, tokens) && !matchAny(subs, tokens) {
+			b.stats.Delete(k)
+		}
+		return true
+	})
+	return nil
+}
+
+// matchAny 是否有订阅者匹配主题
+func matchAny[T any](subs []*busSubscription[T], tokens []string) bool {
+	for _, s := range subs {
+		if matchTopic(s.pattern, tokens) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish 发布事件，topic不能包含通配符
+func (b *Bus[T]) Publish(topic string, v T) error {
+	if _, err := splitTopic(topic, false); err != nil {
+		return err
+	}
+	if err := b.shard(topic).Producer().Write(busEvent[T]{topic: topic, v: v}); err != nil {
+		return err
+	}
+	atomic.AddUint64(&b.topicStats(topic).published, 1)
+	return nil
+}
+
+// Stats 获取所有主题的统计，取消订阅时会删除不再被任何订阅者匹配的主题的统计
+func (b *Bus[T]) Stats() map[string]TopicStats {
+	stats := make(map[string]TopicStats)
+	b.stats.Range(func(k, v any) bool {
+		stats[k.(string)] = v.(*topicStats).load()
+		return true
+	})
+	return stats
+}
+
+// TopicStats 获取指定主题的统计，该主题没有发布过事件时返回false
+func (b *Bus[T]) TopicStats(topic string) (TopicStats, bool) {
+	v, ok := b.stats.Load(topic)
+	if !ok {
+		return TopicStats{}, false
+	}
+	return v.(*topicStats).load(), true
+}
+
+func (b *Bus[T]) Start() error {
+	if atomic.CompareAndSwapInt32(&b.status, READY, RUNNING) {
+		for i, s := range b.shards {
+			if err := s.Start(); err != nil {
+				// 恢复现场
+				for _, x := range b.shards[:i] {
+					_ = x.Close()
+				}
+				atomic.CompareAndSwapInt32(&b.status, RUNNING, READY)
+				return err
+			}
+		}
+		return nil
+	}
+	return startError(b.name)
+}
+
+func (b *Bus[T]) Running() bool {
+	return atomic.LoadInt32(&b.status) == RUNNING
+}
+
+func (b *Bus[T]) Close() error {
+	if atomic.CompareAndSwapInt32(&b.status, RUNNING, READY) {
+		var err error
+		for _, s := range b.shards {
+			if e := s.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+	return closeError(b.name)
+}
+
+func (b *Bus[T]) shard(topic string) *Lockfree[busEvent[T]] {
+	if len(b.shards) == 1 {
+		return b.shards[0]
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(topic))
+	return b.shards[h.Sum32()%uint32(len(b.shards))]
+}
+
+func (b *Bus[T]) loadSubs() []*busSubscription[T] {
+	return b.subs.Load().([]*busSubscription[T])
+}
+
+func (b *Bus[T]) topicStats(topic string) *topicStats {
+	if v, ok := b.stats.Load(topic); ok {
+		return v.(*topicStats)
+	}
+	v, _ := b.stats.LoadOrStore(topic, &topicStats{})
+	return v.(*topicStats)
+}
+
+func (s *topicStats) load() TopicStats {
+	return TopicStats{
+		Published: atomic.LoadUint64(&s.published),
+		Delivered: atomic.LoadUint64(&s.delivered),
+		Unmatched: atomic.LoadUint64(&s.unmatched),
+	}
+}
+
+// busHandler 每个Lockfree的事件处理器，只会被对应的消费端调用，因此匹配缓存不需要加锁
+type busHandler[T any] struct {
+	bus     *Bus[T]
+	version uint64
+	cache   map[string][]*busSubscription[T] // topic -> 匹配的订阅者
+}
+
+func (h *busHandler[T]) OnEvent(v busEvent[T]) {
+	h.onSequenceEvent(v, 0)
+}
+
+func (h *busHandler[T]) onSequenceEvent(v busEvent[T], seq uint64) {
+	subs := h.match(v.topic)
+	stats := h.bus.topicStats(v.topic)
+	if len(subs) == 0 {
+		atomic.AddUint64(&stats.unmatched, 1)
+		return
+	}
+	for _, s := range subs {
+		h.dispatch(s, v, seq)
+	}
+	atomic.AddUint64(&stats.delivered, uint64(len(subs)))
+}
+
+// dispatch 将事件交给订阅者处理，设置了异常处理器时捕获panic，防止影响其他订阅者
+func (h *busHandler[T]) dispatch(s *busSubscription[T], v busEvent[T], seq uint64) {
+	if h.bus.exh != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				h.bus.exh.OnException(v.v, seq, panicError(r))
+			}
+		}()
+	}
+	if s.thdl != nil {
+		s.thdl.OnTopicEvent(v.topic, v.v)
+		return
+	}
+	s.hdl.OnEvent(v.v)
+}
+
+// match 获取匹配主题的订阅者，订阅者变化后重新匹配
+func (h *busHandler[T]) match(topic string) []*busSubscription[T] {
+	if version := atomic.LoadUint64(&h.bus.version); h.cache == nil || version != h.version {
+		h.cache = make(map[string][]*busSubscription[T])
+		h.version = version
+	}
+	if subs, ok := h.cache[topic]; ok {
+		return subs
+	}
+	tokens := strings.Split(topic, topicSeparator)
+	var subs []*busSubscription[T]
+	for _, s := range h.bus.loadSubs() {
+		if matchTopic(s.pattern, tokens) {
+			subs = append(subs, s)
+		}
+	}
+	if len(h.cache) >= busCacheSize {
+		// 主题的数量没有上限，缓存写满时清空，防止缓存无限增长
+		h.cache = make(map[string][]*busSubscription[T])
+	}
+	h.cache[topic] = subs
+	return subs
+}
+
+// matchTopic 判断主题是否匹配订阅的模式
+func matchTopic(pattern, tokens []string) bool {
+	for i, p := range pattern {
+		if p == topicTail {
+			return len(tokens) > i
+		}
+		if i >= len(tokens) || (p != topicWildcard && p != tokens[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(tokens)
+}
+
+// splitTopic 校验并拆分主题，wildcard表示是否允许通配符
+func splitTopic(topic string, wildcard bool) ([]string, error) {
+	tokens := strings.Split(topic, topicSeparator)
+	for i, t := range tokens {
+		if t == "" {
+			return nil, configError("topic %q has empty token", topic)
+		}
+		if t == topicWildcard || t == topicTail {
+			if !wildcard {
+				return nil, configError("topic %q contains wildcard", topic)
+			}
+			if t == topicTail && i != len(tokens)-1 {
+				return nil, configError("topic %q has %q not at the end", topic, topicTail)
+			}
+			continue
+		}
+		if strings.ContainsAny(t, topicWildcard+topicTail) {
+			return nil, configError("topic %q has invalid token %q", topic, t)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.paid", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.created.eu", false},
+		{"*.created", "orders.created", true},
+		{"orders.>", "orders.created.eu", true},
+		{"orders.>", "orders", false},
+		{">", "orders", true},
+		{"orders", "orders.created", false},
+	}
+	for _, c := range cases {
+		pattern, err := splitTopic(c.pattern, true)
+		assert.NoError(t, err)
+		topic, err := splitTopic(c.topic, false)
+		assert.NoError(t, err)
+		assert.Equal(t, c.match, matchTopic(pattern, topic), "%s %s", c.pattern, c.topic)
+	}
+	for _, topic := range []string{"", "orders.", "orders..created", "orders.>.created", "orders.a*"} {
+		_, err := splitTopic(topic, true)
+		assert.ErrorIs(t, err, ErrInvalidConfig, topic)
+	}
+	_, err := splitTopic("orders.*", false)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestBus(t *testing.T) {
+	bus, err := NewBus[int](4, WithCapacity(16))
+	assert.NoError(t, err)
+	assert.NoError(t, bus.Start())
+	created := &collectEventHandler[int]{}
+	all := &collectEventHandler[int]{}
+	_, err = bus.Subscribe("orders.created", created)
+	assert.NoError(t, err)
+	allSub, err := bus.Subscribe("orders.>", all)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for _, topic := range []string{"orders.created", "orders.paid.eu", "users.created"} {
+		wg.Add(1)
+		go func(topic string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				assert.NoError(t, bus.Publish(topic, i))
+			}
+		}(topic)
+	}
+	wg.Wait()
+	assert.Eventually(t, func() bool { return len(all.snapshot()) == 200 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return len(created.snapshot()) == 100 }, time.Second, time.Millisecond)
+	// 实现了 TopicEventHandler 的订阅者收到事件的主题
+	assert.Contains(t, all.keySnapshot(), "orders.paid.eu")
+	assert.NotContains(t, all.keySnapshot(), "users.created")
+	// 同一主题的事件按照发布顺序处理
+	for i, v := range created.snapshot() {
+		assert.Equal(t, i, v)
+	}
+	assert.Eventually(t, func() bool {
+		s, _ := bus.TopicStats("users.created")
+		return s.Unmatched == 100
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, TopicStats{Published: 100, Delivered: 200}, bus.Stats()["orders.created"])
+	assert.Equal(t, TopicStats{Published: 100, Delivered: 100}, bus.Stats()["orders.paid.eu"])
+
+	// 取消订阅后不再收到事件
+	other, err := NewBus[int](1)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, other.Unsubscribe(allSub), ErrInvalidSubscription)
+	assert.NoError(t, bus.Unsubscribe(allSub))
+	assert.Error(t, allSub.Unsubscribe())
+	// 不再被任何订阅者匹配的主题的统计被删除
+	_, ok := bus.TopicStats("orders.paid.eu")
+	assert.False(t, ok)
+	_, ok = bus.TopicStats("orders.created")
+	assert.True(t, ok)
+	assert.NoError(t, bus.Publish("orders.created", 100))
+	assert.Eventually(t, func() bool { return len(created.snapshot()) == 101 }, time.Second, time.Millisecond)
+	assert.Len(t, all.snapshot(), 200)
+
+	assert.ErrorIs(t, bus.Publish("orders.*", 1), ErrInvalidConfig)
+	_, err = bus.Subscribe("orders..x", created)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, ok = bus.TopicStats("missing")
+	assert.False(t, ok)
+	assert.NoError(t, bus.Close())
+	assert.ErrorIs(t, bus.Publish("orders.created", 1), ClosedError)
+}
+
+func TestBusMatchCache(t *testing.T) {
+	bus, err := NewBus[int](1)
+	assert.NoError(t, err)
+	_, err = bus.Subscribe("orders.>", &collectEventHandler[int]{})
+	assert.NoError(t, err)
+	h := &busHandler[int]{bus: bus}
+	// 主题的数量没有上限，缓存不会超过上限
+	for i := 0; i < 2*busCacheSize; i++ {
+		assert.Len(t, h.match(fmt.Sprintf("orders.%d", i)), 1)
+	}
+	assert.LessOrEqual(t, len(h.cache), busCacheSize)
+
+	_, err = NewBus[int](1, WithLaneWeights(1, 2))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+type busPanicHandler struct{}
+
+func (busPanicHandler) OnEvent(v int) {
+	panic(errors.New("bad event"))
+}
+
+func TestBusExceptionHandler(t *testing.T) {
+	exh := &recordExceptionHandler[int]{}
+	bus, err := NewBus[int](1, WithExceptionHandler[int](exh))
+	assert.NoError(t, err)
+	assert.NoError(t, bus.Start())
+	ok := &collectEventHandler[int]{}
+	_, err = bus.Subscribe("a", busPanicHandler{})
+	assert.NoError(t, err)
+	_, err = bus.Subscribe("a", ok)
+	assert.NoError(t, err)
+	assert.NoError(t, bus.Publish("a", 1))
+	// 一个订阅者panic不影响其他订阅者
+	assert.Eventually(t, func() bool { return len(ok.snapshot()) == 1 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return exh.len() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []uint64{1}, exh.seqs)
+	assert.NoError(t, bus.Close())
+
+	_, err = NewBus[int](1, WithExceptionHandler[string](&recordExceptionHandler[string]{}))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
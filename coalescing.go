@@ -0,0 +1,190 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyEventHandler 带有键的事件处理器，Coalescing的事件处理器实现该接口时会收到事件的键
+type KeyEventHandler[K comparable, T any] interface {
+	OnKeyEvent(key K, t T)
+}
+
+// Coalescing 按键合并的队列，用于只关心每个键最新值的场景（如行情数据）。
+// 写入的键尚未被消费时直接替换其值，不会占用新的位置，因此消费端落后时不会处理过期的值；
+// 事件按照键第一次写入（即键被消费后再次写入）的顺序处理。
+// buffer中只保存键，值保存在由互斥锁保护的map中，替换与消费之间通过该锁保证不会丢失最新的值
+type Coalescing[K comparable, T any] struct {
+	lf        *Lockfree[K]
+	hdl       EventHandler[T]
+	khdl      KeyEventHandler[K, T]
+	dhdl      deadlineHandler // 需要按照截止时间调用的事件处理器（如 Batcher），由hdl选择实现
+	exh       ExceptionHandler[T]
+	mu        sync.Mutex
+	values    map[K]*coalescingEntry[T] // 尚未被消费的键及其最新的值
+	coalesced uint64                    // 被替换的值的数量
+}
+
+// coalescingEntry 尚未被消费的键对应的值
+type coalescingEntry[T any] struct {
+	v T
+}
+
+// NewCoalescing 通过配置项创建按键合并的队列，配置项参考 New，不支持 WithEventFactory、WithSpill、WithRetry 及死信；
+// handler实现了 KeyEventHandler 时调用 OnKeyEvent，否则调用 OnEvent，设置 WithExceptionHandler 时处理器的panic会交由异常处理器处理
+func NewCoalescing[K comparable, T any](handler EventHandler[T], opts ...Option) (*Coalescing[K, T], error) {
+	if handler == nil {
+		return nil, configError("event handler is nil")
+	}
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.factory != nil || o.spill != nil || o.retry != nil || o.deadLetter != nil || o.weights != nil {
+		return nil, configError("event factory, spill, retry, dead letter and lane weights are not supported by coalescing")
+	}
+	if err := checkBaseOptions[T](o); err != nil {
+		return nil, err
+	}
+	o.capacity, _ = NextPowerOfTwo(o.capacity)
+	c := &Coalescing[K, T]{
+		hdl:    handler,
+		values: make(map[K]*coalescingEntry[T]),
+	}
+	c.khdl, _ = handler.(KeyEventHandler[K, T])
+	c.dhdl, _ = handler.(deadlineHandler)
+	c.exh, _ = o.exception.(ExceptionHandler[T])
+	ko := *o
+	ko.exception = nil
+	c.lf = newLockfree[K](&coalescingHandler[K, T]{c: c}, &ko, nil)
+	return c, nil
+}
+
+// Write 写入键及其值，该键尚未被消费时替换其值并直接返回，否则占用buffer中的一个位置，buffer写满时会等待；
+// 该键正在写入buffer时（如buffer已满）同样替换值后直接返回，之后写入失败（如已关闭）时由占用位置的写入返回错误
+func (c *Coalescing[K, T]) Write(key K, v T) error {
+	w := c.lf.Producer()
+	if w.closed() {
+		return writeError(w.name, 0, ErrClosed)
+	}
+	c.mu.Lock()
+	if e, exist := c.values[key]; exist {
+		e.v = v
+		atomic.AddUint64(&c.coalesced, 1)
+		c.mu.Unlock()
+		return nil
+	}
+	e := &coalescingEntry[T]{v: v}
+	c.values[key] = e
+	c.mu.Unlock()
+	err := w.Write(key)
+	if err != nil {
+		// 键未能写入buffer，不会被消费，移除后该键再次写入时会重新占用位置
+		c.mu.Lock()
+		if c.values[key] == e {
+			delete(c.values, key)
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// Len 尚未被消费的键的数量
+func (c *Coalescing[K, T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.values)
+}
+
+// Coalesced 被替换（即未被处理）的值的数量
+func (c *Coalescing[K, T]) Coalesced() uint64 {
+	return atomic.LoadUint64(&c.coalesced)
+}
+
+func (c *Coalescing[K, T]) Start() error {
+	return c.lf.Start()
+}
+
+func (c *Coalescing[K, T]) Running() bool {
+	return c.lf.Running()
+}
+
+func (c *Coalescing[K, T]) Close() error {
+	return c.lf.Close()
+}
+
+// take 取出键最新的值，取出后该键再次写入时会占用新的位置
+func (c *Coalescing[K, T]) take(key K) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.values[key]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	delete(c.values, key)
+	return e.v, true
+}
+
+// coalescingHandler 内部Lockfree的事件处理器，根据键取出最新的值并交给用户的事件处理器
+type coalescingHandler[K comparable, T any] struct {
+	c *Coalescing[K, T]
+}
+
+func (h *coalescingHandler[K, T]) OnEvent(key K) {
+	h.onSequenceEvent(key, 0)
+}
+
+func (h *coalescingHandler[K, T]) onSequenceEvent(key K, seq uint64) {
+	c := h.c
+	v, ok := c.take(key)
+	if !ok {
+		// 写入buffer失败时已移除
+		return
+	}
+	if c.exh != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				c.exh.OnException(v, seq, panicError(r))
+			}
+		}()
+	}
+	if c.khdl != nil {
+		c.khdl.OnKeyEvent(key, v)
+		return
+	}
+	c.hdl.OnEvent(v)
+}
+
+// deadline 转发用户事件处理器的截止时间
+func (h *coalescingHandler[K, T]) deadline() (time.Time, bool) {
+	if h.c.dhdl == nil {
+		return time.Time{}, false
+	}
+	return h.c.dhdl.deadline()
+}
+
+// expire 调用用户事件处理器的expire，设置了异常处理器时panic交由异常处理器处理，此时事件为零值，序号为0
+func (h *coalescingHandler[K, T]) expire() {
+	c := h.c
+	if c.dhdl == nil {
+		return
+	}
+	if c.exh != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				var zero T
+				c.exh.OnException(zero, 0, panicError(r))
+			}
+		}()
+	}
+	c.dhdl.expire()
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalescing(t *testing.T) {
+	h := newGateEventHandler[int]()
+	c, err := NewCoalescing[string, int](h, WithCapacity(4))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Start())
+	defer c.Close()
+
+	assert.NoError(t, c.Write("first", 0))
+	<-h.entered
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, c.Write("a", i))
+	}
+	assert.NoError(t, c.Write("b", 1))
+	assert.NoError(t, c.Write("a", 6))
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, uint64(5), c.Coalesced())
+
+	close(h.gate)
+	assert.Eventually(t, func() bool {
+		return len(h.snapshot()) == 3
+	}, 5*time.Second, time.Millisecond)
+	// 按照键第一次写入的顺序处理，只处理最新的值
+	assert.Equal(t, []string{"first", "a", "b"}, h.keySnapshot())
+	assert.Equal(t, []int{0, 6, 1}, h.snapshot())
+	assert.Equal(t, 0, c.Len())
+
+	// 键被消费后再次写入会重新占用位置
+	assert.NoError(t, c.Write("a", 7))
+	assert.Eventually(t, func() bool {
+		return len(h.snapshot()) == 4
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, "a", h.keySnapshot()[3])
+	assert.Equal(t, 7, h.snapshot()[3])
+}
+
+func TestCoalescingConcurrent(t *testing.T) {
+	h := &latestEventHandler{latest: make(map[int]int)}
+	c, err := NewCoalescing[int, int](h, WithCapacity(16))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Start())
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for k := 0; k < 4; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			for i := 1; i <= 1000; i++ {
+				assert.NoError(t, c.Write(k, i))
+			}
+		}(k)
+	}
+	wg.Wait()
+	// 每个键最终都会处理到最新的值
+	assert.Eventually(t, func() bool {
+		return h.equal(map[int]int{0: 1000, 1: 1000, 2: 1000, 3: 1000})
+	}, 5*time.Second, time.Millisecond)
+}
+
+// latestEventHandler 记录每个键最后处理的值，并检查值不会回退
+type latestEventHandler struct {
+	mu     sync.Mutex
+	latest map[int]int
+	stale  bool
+}
+
+func (h *latestEventHandler) OnEvent(v int) {}
+
+func (h *latestEventHandler) OnKeyEvent(key int, v int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if v <= h.latest[key] {
+		h.stale = true
+	}
+	h.latest[key] = v
+}
+
+func (h *latestEventHandler) equal(m map[int]int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stale || len(h.latest) != len(m) {
+		return false
+	}
+	for k, v := range m {
+		if h.latest[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCoalescingWriteFailure(t *testing.T) {
+	h := newGateEventHandler[int]()
+	defer close(h.gate)
+	c, err := NewCoalescing[string, int](h, WithCapacity(2))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Start())
+
+	// 第一个键被读取后消费端阻塞，之后写满buffer，键c的写入等待buffer中的位置
+	assert.NoError(t, c.Write("first", 0))
+	<-h.entered
+	assert.NoError(t, c.Write("a", 1))
+	assert.NoError(t, c.Write("b", 1))
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Write("c", 1)
+	}()
+	assert.Eventually(t, func() bool {
+		return c.Len() == 3
+	}, 5*time.Second, time.Millisecond)
+	// 替换正在写入的键的值时不等待写入完成
+	assert.NoError(t, c.Write("c", 2))
+	assert.Equal(t, uint64(1), c.Coalesced())
+	assert.Len(t, errs, 0)
+
+	// 键c写入失败时由占用位置的写入返回错误，并移除该键
+	assert.NoError(t, c.Close())
+	assert.ErrorIs(t, <-errs, ErrClosed)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestCoalescingOptions(t *testing.T) {
+	_, err := NewCoalescing[string, int](nil)
+	assert.Error(t, err)
+	_, err = NewCoalescing[string, int](newGateEventHandler[int](), WithEventFactory[int](func() int { return 0 }))
+	assert.Error(t, err)
+
+	c, err := NewCoalescing[string, int](newGateEventHandler[int]())
+	assert.NoError(t, err)
+	assert.ErrorIs(t, c.Write("a", 1), ClosedError)
+	assert.Equal(t, 0, c.Len())
+}
@@ -8,63 +8,143 @@
 package lockfree
 
 import (
-	"fmt"
 	"runtime"
 	"sync/atomic"
+	"time"
 )
 
+// scheduleInterval 连续读取到该数量的事件后检查一次定时事件
+const scheduleInterval = 256
+
 // consumer 消费者，这个消费者只会有一个g操作，这样处理的好处是可以不涉及并发操作，其内部不会涉及到任何锁
 // 对于实际的并发操作由该g进行分配
 type consumer[T any] struct {
-	status int32 // 运行状态
-	rbuf   *ringBuffer[T]
-	seqer  *sequencer
-	blocks blockStrategy
-	hdl    EventHandler[T]
+	status  int32 // 运行状态
+	rbuf    *ringBuffer[T]
+	seqer   *sequencer
+	blocks  blockStrategy
+	pblocks *sharedBlockStrategy // 生产端阻塞策略，读取后释放
+	hdl     EventHandler[T]
+	clr     EventClearer[T] // 事件清理器，由hdl选择实现
+	hold    bool            // 是否在事件处理完成后再释放对应位置
+	exh     ExceptionHandler[T]
+	seqHdl  sequenceHandler[T] // 需要序号的事件处理器，由hdl选择实现
+	bhdl    batchHandler       // 需要批次结束通知的事件处理器，由hdl选择实现
+	spill   *spillQueue[T]     // 溢出队列，未设置溢出模式时为nil
+	sched   *scheduler[T]      // 定时事件调度器，不支持定时写入时为nil
+	retry   *RetryPolicy       // 重试策略，未设置时为nil
+	dead    deadLetterFunc[T]  // 死信处理，未设置时为nil
+	dhdl    deadlineHandler    // 需要按照截止时间调用的事件处理器，由hdl选择实现
+	wake    *alarm             // 定时唤醒，用于定时事件及截止时间，为nil时不会定时唤醒
+	limiter *tokenBucket       // 限流，未设置时为nil
+	stall   *stallWatch        // 停滞检测，未设置时为nil
+	mark    *watermark         // 积压水位采样，未设置时为nil
+	done    chan struct{}      // 消费端的g退出时关闭，未启动时为nil
 }
 
-func newConsumer[T any](rbuf *ringBuffer[T], hdl EventHandler[T], sequer *sequencer, blocks blockStrategy) *consumer[T] {
+func newConsumer[T any](rbuf *ringBuffer[T], hdl EventHandler[T], sequer *sequencer, blocks blockStrategy,
+	pblocks *sharedBlockStrategy, reuse bool, exh ExceptionHandler[T]) *consumer[T] {
+	clr, _ := hdl.(EventClearer[T])
+	seqHdl := asSequenceHandler[T](hdl)
+	bhdl, _ := hdl.(batchHandler)
+	dhdl, _ := hdl.(deadlineHandler)
 	return &consumer[T]{
-		rbuf:   rbuf,
-		seqer:  sequer,
-		hdl:    hdl,
-		blocks: blocks,
-		status: READY,
+		dhdl:    dhdl,
+		seqHdl:  seqHdl,
+		bhdl:    bhdl,
+		rbuf:    rbuf,
+		seqer:   sequer,
+		hdl:     hdl,
+		clr:     clr,
+		exh:     exh,
+		hold:    reuse || clr != nil,
+		blocks:  blocks,
+		pblocks: pblocks,
+		status:  READY,
 	}
 }
 
 func (c *consumer[T]) start() error {
 	if atomic.CompareAndSwapInt32(&c.status, READY, RUNNING) {
-		go c.handle()
+		done := make(chan struct{})
+		c.done = done
+		go func() {
+			defer close(done)
+			c.handle()
+		}()
 		return nil
 	}
-	return fmt.Errorf(StartErrorFormat, "Consumer")
+	return startError("Consumer")
+}
+
+// wait 等待消费端的g退出，需要在close之后调用，未启动时直接返回
+func (c *consumer[T]) wait() {
+	if c.done != nil {
+		<-c.done
+	}
 }
 
 func (c *consumer[T]) handle() {
 	// 判断是否可以获取到
 	rc := c.seqer.nextRead()
+	// 是否有尚未通知批次结束的事件
+	var batching = false
+	// 连续读取到的事件数量，用于在buffer一直有事件时也能处理到期的定时事件
+	var hits uint
 	for {
 		if c.closed() {
+			c.exit(batching)
 			return
 		}
 		var i = 0
 		for {
 			if c.closed() {
+				c.exit(batching)
 				return
 			}
 			// 看下读取位置的seq是否OK
-			if v, p, exist := c.rbuf.contains(rc - 1); exist {
-				rc = c.seqer.readIncrement()
-				c.hdl.OnEvent(v)
+			if p, ok := c.consume(rc); ok {
+				rc = c.seqer.nextRead()
+				c.sample(rc, false)
+				if hits++; hits%scheduleInterval == 0 {
+					c.schedule()
+					c.expire()
+				}
+				batching = true
+				i = 0
+				break
+			} else if c.takeSpill(rc) {
+				// 该序号的事件在溢出文件中
+				rc = c.seqer.nextRead()
+				c.sample(rc, false)
+				batching = true
+				i = 0
+				break
+			} else if c.schedule() {
+				// 有到期的定时事件
+				batching = true
+				i = 0
+				break
+			} else if c.expire() {
+				// 事件处理器的截止时间已到
+				i = 0
+				break
+			} else if c.stalled(rc) {
+				// 跳过了停滞的序号
+				rc = c.seqer.nextRead()
 				i = 0
 				break
 			} else {
+				// 暂时读取不到新的事件，表示一个批次结束
+				c.sample(rc, true)
+				c.endBatch(batching)
+				batching = false
 				if i < spin {
 					procyield(30)
 				} else if i < spin+passiveSpin {
 					runtime.Gosched()
 				} else {
+					c.arm(rc)
 					c.blocks.block(p, rc)
 					i = 0
 				}
@@ -74,13 +154,231 @@ func (c *consumer[T]) handle() {
 	}
 }
 
+// consume 处理序号为rc的事件并推进读取游标，该事件尚未写入时返回false，同时返回该位置游标的地址，用于阻塞等待
+func (c *consumer[T]) consume(rc uint64) (*uint64, bool) {
+	v, p, exist := c.rbuf.contains(rc - 1)
+	if !exist {
+		return p, false
+	}
+	if c.hold {
+		// 位置上的对象会被复用，需要处理完成后再释放，防止处理过程中被生产者修改
+		c.dispatch(v, rc)
+		if c.clr != nil {
+			c.clr.Clear(c.rbuf.slot(rc - 1))
+		}
+		c.seqer.readIncrement()
+		c.pblocks.release()
+	} else {
+		c.seqer.readIncrement()
+		// 读取游标已推进，释放因buffer写满而阻塞的生产者
+		c.pblocks.release()
+		c.dispatch(v, rc)
+	}
+	return p, true
+}
+
+// schedule 处理到期的定时事件，定时事件没有序号，处理时的序号为0，没有到期的事件时返回false
+func (c *consumer[T]) schedule() bool {
+	if c.sched == nil {
+		return false
+	}
+	expired := c.sched.poll()
+	for _, e := range expired {
+		c.dispatch(e.v, 0)
+	}
+	return len(expired) > 0
+}
+
+// expire 事件处理器的截止时间已到时调用，没有到达截止时间时返回false
+func (c *consumer[T]) expire() bool {
+	if c.dhdl == nil {
+		return false
+	}
+	if d, ok := c.dhdl.deadline(); !ok || time.Now().Before(d) {
+		return false
+	}
+	c.onExpire()
+	return true
+}
+
+// onExpire 调用事件处理器的expire，设置了异常处理器时会捕获panic并交由异常处理器处理，此时事件为零值，序号为0
+func (c *consumer[T]) onExpire() {
+	if c.exh == nil {
+		c.dhdl.expire()
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c.exh.OnException(c.rbuf.tDefault, 0, panicError(r))
+		}
+	}()
+	c.dhdl.expire()
+}
+
+// arm 阻塞前按照最近的定时事件、事件处理器的截止时间及停滞检测的时间设置定时器，到期后唤醒
+func (c *consumer[T]) arm(rc uint64) {
+	if c.wake == nil {
+		return
+	}
+	// 之前触发的唤醒已在本轮循环中处理，无论是否设置新的唤醒时间都需要清除
+	c.wake.reset()
+	var next time.Time
+	var ok bool
+	if c.sched != nil {
+		next, ok = c.sched.next()
+	}
+	if c.dhdl != nil {
+		if d, has := c.dhdl.deadline(); has && (!ok || d.Before(next)) {
+			next, ok = d, true
+		}
+	}
+	// 尚未获取该序号时不会停滞，有新的写入时会释放消费端
+	if w := c.stall; w != nil && w.seq == rc && c.seqer.wc.atomicLoad() >= rc && (!ok || w.check.Before(next)) {
+		next, ok = w.check, true
+	}
+	if ok {
+		c.wake.set(next)
+	}
+}
+
+// exit 消费端退出，需要按照截止时间调用的事件处理器会立即调用，防止尚未处理的内容（如未满的批次）丢失
+func (c *consumer[T]) exit(batching bool) {
+	c.endBatch(batching)
+	if c.dhdl != nil {
+		c.onExpire()
+	}
+	if c.wake != nil {
+		c.wake.stop()
+	}
+}
+
+// takeSpill 从溢出文件中读取序号为rc的事件并处理，该序号的事件不在溢出文件中时返回false
+func (c *consumer[T]) takeSpill(rc uint64) bool {
+	if c.spill == nil || c.spill.size() == 0 {
+		return false
+	}
+	v, ok, err := c.spill.take(rc)
+	if !ok {
+		if err != nil {
+			// 溢出文件读取失败，后续溢出的事件均无法读取
+			panic(err)
+		}
+		return false
+	}
+	c.seqer.readIncrement()
+	c.pblocks.release()
+	if err == nil {
+		c.dispatch(v, rc)
+	} else if c.exh != nil {
+		c.exh.OnException(v, rc, err)
+	} else {
+		panic(err)
+	}
+	return true
+}
+
+// dispatch 将事件交给事件处理器处理，设置了异常处理器、重试策略或死信时会捕获处理器的panic，
+// 按照重试策略重新处理，仍然失败时依次交由死信及异常处理器处理，均未设置时继续抛出；设置了限流时会先等待令牌
+func (c *consumer[T]) dispatch(v T, seq uint64) {
+	if c.limiter != nil {
+		// 超过速率时等待，关闭时不再等待
+		c.limiter.wait(c.closed)
+	}
+	if c.exh == nil && c.retry == nil && c.dead == nil {
+		c.onEvent(v, seq)
+		return
+	}
+	attempts, err := c.attempt(v, seq)
+	if err == nil {
+		return
+	}
+	if c.dead != nil {
+		if c.dead(DeadLetter[T]{Value: v, Sequence: seq, Err: err, Attempts: attempts}) == nil || c.exh == nil {
+			return
+		}
+	}
+	if c.exh != nil {
+		c.exh.OnException(v, seq, err)
+		return
+	}
+	panic(err)
+}
+
+// attempt 按照重试策略处理事件，返回处理次数及最后一次处理的错误
+func (c *consumer[T]) attempt(v T, seq uint64) (int, error) {
+	if c.retry == nil || c.retry.MaxAttempts <= 1 {
+		return 1, c.try(v, seq)
+	}
+	backoff := c.retry.Backoff
+	for n := 1; ; n++ {
+		err := c.try(v, seq)
+		if err == nil || n >= c.retry.MaxAttempts {
+			return n, err
+		}
+		// 消费端关闭后不再重试，交由死信或异常处理器处理
+		if !c.pause(backoff) {
+			return n, err
+		}
+		backoff = c.retry.next(backoff)
+	}
+}
+
+// try 处理事件，将事件处理器的panic转换为error
+func (c *consumer[T]) try(v T, seq uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+		}
+	}()
+	c.onEvent(v, seq)
+	return nil
+}
+
+func (c *consumer[T]) onEvent(v T, seq uint64) {
+	if c.seqHdl != nil {
+		c.seqHdl.onSequenceEvent(v, seq)
+		return
+	}
+	c.hdl.OnEvent(v)
+}
+
+// endBatch 通知事件处理器批次结束
+func (c *consumer[T]) endBatch(batching bool) {
+	if batching && c.bhdl != nil {
+		c.bhdl.onBatchEnd()
+	}
+}
+
+// stats 获取消费端的统计
+func (c *consumer[T]) stats() Stats {
+	consumed := c.seqer.nextRead() - 1
+	written := c.seqer.wc.atomicLoad()
+	stats := Stats{
+		Written:  written,
+		Consumed: consumed,
+	}
+	if written > consumed {
+		stats.Pending = written - consumed
+	}
+	if b := c.limiter; b != nil {
+		stats.Throttled = atomic.LoadInt32(&b.throttled) == 1
+		stats.ThrottleWaits = atomic.LoadUint64(&b.waits)
+		stats.ThrottleTime = time.Duration(atomic.LoadInt64(&b.waited))
+	}
+	if w := c.stall; w != nil {
+		stats.Stalls = atomic.LoadUint64(&w.stalls)
+		stats.Skipped = atomic.LoadUint64(&w.skipped)
+	}
+	return stats
+}
+
 func (c *consumer[T]) close() error {
 	if atomic.CompareAndSwapInt32(&c.status, RUNNING, READY) {
 		// 防止阻塞无法释放
 		c.blocks.release()
 		return nil
 	}
-	return fmt.Errorf(CloseErrorFormat, "Consumer")
+	return closeError("Consumer")
 }
 
 // closed 判断是否已关闭
@@ -27,6 +27,13 @@ func (c *cursor) increment() uint64 {
 	return atomic.AddUint64(&c.v, 1)
 }
 
+// incrementSingle 仅有一个g自增时使用，不需要原子的读改写操作，通过原子写保证其他g读取时的可见性
+func (c *cursor) incrementSingle() uint64 {
+	v := c.v + 1
+	atomic.StoreUint64(&c.v, v)
+	return v
+}
+
 func (c *cursor) atomicLoad() uint64 {
 	return atomic.LoadUint64(&c.v)
 }
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 错误类型，返回的错误可能被 QueueError 包装，需要通过errors.Is判断
+var (
+	// ErrClosed 已关闭（或尚未启动），与 ClosedError 为同一个错误
+	ErrClosed = errors.New("the queue has been closed")
+	// ErrAlreadyStarted 重复启动
+	ErrAlreadyStarted = errors.New("already started")
+	// ErrNotRunning 未运行时关闭，如重复关闭
+	ErrNotRunning = errors.New("not running")
+	// ErrFull buffer已满，参考 Producer.TryWrite
+	ErrFull = errors.New("the queue is full")
+	// ErrTimeout 等待超时，参考 Producer.TryWriteTimeout
+	ErrTimeout = errors.New("timeout")
+	// ErrInvalidCursor 写入位置不合法，参考 Producer.WriteByCursor
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrThrottled 写入超过准入控制的限制，参考 Producer.WithLimiter
+	ErrThrottled = errors.New("the write has been throttled")
+	// ErrUnsupported 当前配置不支持该操作，如事件处理器为 JournalHandler 时的定时写入
+	ErrUnsupported = errors.New("not supported")
+	// ErrInvalidPriority 优先级超出范围，参考 Producer.WriteWithPriority
+	ErrInvalidPriority = errors.New("invalid priority")
+	// ErrInvalidConfig 配置不合法，创建时返回
+	ErrInvalidConfig = errors.New("invalid config")
+	// ErrInvalidSubscription 订阅者不属于该组件，参考 Broadcast.Unsubscribe 及 Bus.Unsubscribe
+	ErrInvalidSubscription = errors.New("invalid subscription")
+)
+
+// QueueError 队列操作的错误，包含组件名称、操作及相关的序号，具体的错误类型通过errors.Is判断
+type QueueError struct {
+	Name     string // 组件名称，如Lockfree的名称、Producer、Consumer
+	Op       string // 操作，如start、close、write、replay
+	Sequence uint64 // 相关的序号，没有时为0
+	Err      error
+}
+
+func (e *QueueError) Error() string {
+	if e.Sequence > 0 {
+		return fmt.Sprintf("%s model [%s] error at sequence %d: %v", e.Op, e.Name, e.Sequence, e.Err)
+	}
+	return fmt.Sprintf("%s model [%s] error: %v", e.Op, e.Name, e.Err)
+}
+
+func (e *QueueError) Unwrap() error {
+	return e.Err
+}
+
+// startError 重复启动的错误
+func startError(name string) error {
+	return &QueueError{Name: name, Op: "start", Err: ErrAlreadyStarted}
+}
+
+// closeError 未运行时关闭的错误
+func closeError(name string) error {
+	return &QueueError{Name: name, Op: "close", Err: ErrNotRunning}
+}
+
+// writeError 写入的错误
+func writeError(name string, seq uint64, err error) error {
+	return &QueueError{Name: name, Op: "write", Sequence: seq, Err: err}
+}
+
+// unsubscribeError 取消订阅的错误
+func unsubscribeError(name string, err error) error {
+	return &QueueError{Name: name, Op: "unsubscribe", Err: err}
+}
+
+// replayError 回放预写日志的错误
+func replayError(name string, err error) error {
+	return &QueueError{Name: name, Op: "replay", Err: err}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueError(t *testing.T) {
+	err := writeError("orders", 5, ErrClosed)
+	assert.EqualError(t, err, "write model [orders] error at sequence 5: the queue has been closed")
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, err, ClosedError)
+	var qe *QueueError
+	if assert.True(t, errors.As(err, &qe)) {
+		assert.Equal(t, "orders", qe.Name)
+		assert.Equal(t, "write", qe.Op)
+		assert.Equal(t, uint64(5), qe.Sequence)
+	}
+}
+
+func TestLifecycleErrors(t *testing.T) {
+	h := newGateEventHandler[int]()
+	l, err := New[int](h, WithName("orders"), WithCapacity(2))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, l.Close(), ErrNotRunning)
+
+	var qe *QueueError
+	err = l.Producer().Write(1)
+	assert.ErrorIs(t, err, ErrClosed)
+	if assert.True(t, errors.As(err, &qe)) {
+		assert.Equal(t, "orders", qe.Name)
+	}
+
+	assert.NoError(t, l.Start())
+	err = l.Start()
+	assert.ErrorIs(t, err, ErrAlreadyStarted)
+	assert.False(t, errors.Is(err, ErrNotRunning))
+	assert.NoError(t, l.Close())
+	assert.ErrorIs(t, l.Close(), ErrNotRunning)
+}
+
+func TestTryWrite(t *testing.T) {
+	h := newGateEventHandler[int]()
+	l, err := New[int](h, WithCapacity(2))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	p := l.Producer()
+	// 第一个事件被读取后消费端阻塞，之后写满buffer
+	assert.NoError(t, p.TryWrite(0))
+	<-h.entered
+	assert.NoError(t, p.TryWrite(1))
+	assert.NoError(t, p.TryWrite(2))
+	assert.ErrorIs(t, p.TryWrite(3), ErrFull)
+	start := time.Now()
+	assert.ErrorIs(t, p.TryWriteTimeout(3, 10*time.Millisecond), ErrTimeout)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+
+	// 超时后未占用写入位置，不影响后续的写入
+	close(h.gate)
+	assert.NoError(t, p.TryWriteTimeout(3, time.Second))
+	assert.Eventually(t, func() bool {
+		return h.count() == 4
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []int{0, 1, 2, 3}, h.snapshot())
+}
+
+func TestWriteByCursorInvalid(t *testing.T) {
+	h := newGateEventHandler[int]()
+	l, err := New[int](h, WithCapacity(2))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	p := l.Producer()
+	assert.NoError(t, p.Write(0))
+	<-h.entered
+	assert.NoError(t, p.Write(1))
+	assert.NoError(t, p.Write(2))
+	wc, ok, err := p.WriteTimeout(3, time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, uint64(4), wc)
+
+	assert.Equal(t, []uint64{4}, p.PendingCursors())
+
+	// 未获取、已写入及未记录的位置均不合法
+	cases := []uint64{0, 1, 3, 5}
+	for _, c := range cases {
+		_, err = p.WriteByCursor(3, c)
+		assert.ErrorIs(t, err, ErrInvalidCursor, "cursor %d", c)
+	}
+	// buffer已满时写入失败，位置仍被记录，可以重复写入
+	ok, err = p.WriteByCursor(3, wc)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []uint64{4}, p.PendingCursors())
+
+	close(h.gate)
+	assert.Eventually(t, func() bool {
+		ok, err := p.WriteByCursor(3, wc)
+		assert.NoError(t, err)
+		return ok
+	}, 5*time.Second, time.Millisecond)
+	assert.Empty(t, p.PendingCursors())
+	_, err = p.WriteByCursor(3, wc)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	assert.Eventually(t, func() bool {
+		return h.count() == 4
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestUnsupportedWriteErrors(t *testing.T) {
+	l, err := New[int](newGateEventHandler[int](), WithName("orders"))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+	err = l.Producer().WriteWithPriority(1, 1)
+	assert.ErrorIs(t, err, ErrInvalidPriority)
+	assert.EqualError(t, err, "write model [orders] error: invalid priority: 1 out of range [0, 1)")
+
+	p, err := NewPriority[int](newGateEventHandler[int](), 2)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, p.Producer().WriteWithPriority(1, 2), ErrInvalidPriority)
+
+	journal, err := NewJournalHandler[journalEntry](&collectEventHandler[journalEntry]{}, JSONCodec[journalEntry]{},
+		JournalConfig[journalEntry]{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	defer journal.Close()
+	jl, err := New[journalEntry](journal, WithName("journal"))
+	assert.NoError(t, err)
+	assert.NoError(t, jl.Start())
+	defer jl.Close()
+	var qe *QueueError
+	err = jl.Producer().WriteAfter(journalEntry{ID: 1}, time.Millisecond)
+	assert.ErrorIs(t, err, ErrUnsupported)
+	if assert.True(t, errors.As(err, &qe)) {
+		assert.Equal(t, "journal", qe.Name)
+	}
+	err = jl.Replay(1)
+	assert.ErrorIs(t, err, ErrAlreadyStarted)
+	if assert.True(t, errors.As(err, &qe)) {
+		assert.Equal(t, "replay", qe.Op)
+	}
+}
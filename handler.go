@@ -7,6 +7,8 @@
 
 package lockfree
 
+import "time"
+
 // EventHandler 事件处理器接口
 // 整个无锁队列中唯一需要用户实现的接口，该接口描述消费端收到消息时该如何处理
 // 使用泛型，通过编译阶段确定事件类型，提高性能
@@ -14,3 +16,76 @@ type EventHandler[T any] interface {
 	// OnEvent 用户侧实现，事件处理方法
 	OnEvent(t T)
 }
+
+// SequencedEventHandler 需要事件序号的事件处理器，可由事件处理器选择实现
+// 若实现了该接口，消费端会调用OnSequenceEvent并同时传入事件对应的序号，而不再调用OnEvent，
+// 序号与 Producer.WriteTimeout 返回的写入位置一致，可用于幂等处理、记录检查点等；
+// 定时事件（参考 Producer.WriteAt）没有序号，处理时的序号为0，PriorityLockfree 中各通道的序号相互独立
+type SequencedEventHandler[T any] interface {
+	EventHandler[T]
+	// OnSequenceEvent 用户侧实现，事件处理方法，seq为事件对应的序号
+	OnSequenceEvent(t T, seq uint64)
+}
+
+// ExceptionHandler 异常处理器，事件处理器发生panic时被调用，通过 WithExceptionHandler 设置
+type ExceptionHandler[T any] interface {
+	// OnException 处理异常，seq为事件对应的序号，err为panic内容转换的错误
+	OnException(t T, seq uint64, err error)
+}
+
+// EventFactory 事件工厂，用于在创建时一次性填充ringBuffer中的每个位置
+// 对于包含内部缓冲（如字节切片、map）的事件，配合 Producer.Publish 等转换器方法直接修改位置上的对象，
+// 可以在多轮之间复用这些对象，而不是每条消息都重新申请内存
+type EventFactory[T any] func() T
+
+// EventClearer 事件清理接口，可由事件处理器选择实现
+// 若实现了该接口，消费端会在 OnEvent 处理完成后、释放该位置之前调用 Clear，用于清理位置上的对象以便下一轮复用
+type EventClearer[T any] interface {
+	// Clear 清理指定位置上的对象
+	Clear(t *T)
+}
+
+// sequenceHandler 内部使用的事件处理器接口，消费端在创建时检测事件处理器是否实现了该接口，
+// 实现的话会调用onSequenceEvent并同时传入事件对应的序号，而不再调用OnEvent
+type sequenceHandler[T any] interface {
+	onSequenceEvent(t T, seq uint64)
+}
+
+// sequencedHandler 将 SequencedEventHandler 转换为内部使用的 sequenceHandler
+type sequencedHandler[T any] struct {
+	h SequencedEventHandler[T]
+}
+
+func (s sequencedHandler[T]) onSequenceEvent(t T, seq uint64) {
+	s.h.OnSequenceEvent(t, seq)
+}
+
+// asSequenceHandler 检测事件处理器是否需要序号，未实现 SequencedEventHandler 及sequenceHandler时返回nil
+func asSequenceHandler[T any](hdl EventHandler[T]) sequenceHandler[T] {
+	if h, ok := hdl.(sequenceHandler[T]); ok {
+		return h
+	}
+	if h, ok := hdl.(SequencedEventHandler[T]); ok {
+		return sequencedHandler[T]{h: h}
+	}
+	return nil
+}
+
+// batchHandler 内部使用的事件处理器接口，消费端暂时读取不到新的事件或关闭时，表示一个批次结束，会调用onBatchEnd进行通知
+type batchHandler interface {
+	onBatchEnd()
+}
+
+// deadlineHandler 内部使用的事件处理器接口，事件处理器需要在指定的时间被调用时实现（如定时刷新的批量处理），
+// 即使没有新的事件，消费端也会在deadline返回的时间之后调用expire，返回false时表示没有截止时间；
+// 消费端退出时也会调用expire
+type deadlineHandler interface {
+	deadline() (time.Time, bool)
+	expire()
+}
+
+// retainHandler 内部使用的事件处理器接口，事件处理器在OnEvent返回后仍会持有事件时实现（如批量处理），
+// 此时位置上的对象不能被复用，事件也不能重试（失败的事件可能已在持有的批次中，重试会导致重复）
+type retainHandler interface {
+	retain()
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// countEventHandler 计数性质的事件处理器
+type countEventHandler[T any] struct {
+	count int64
+}
+
+func (h *countEventHandler[T]) OnEvent(v T) {
+	atomic.AddInt64(&h.count, 1)
+}
+
+func (h *countEventHandler[T]) load() int64 {
+	return atomic.LoadInt64(&h.count)
+}
+
+// collectEventHandler 收集所有事件的处理器，同时记录事件的序号及处理时间；
+// 作为 TopicEventHandler 或 KeyEventHandler（键为string）使用时记录主题或键，check不为nil时在记录前调用
+type collectEventHandler[T any] struct {
+	mu     sync.Mutex
+	events []T
+	seqs   []uint64
+	times  []time.Time
+	keys   []string
+	check  func(v T, seq uint64)
+}
+
+func (h *collectEventHandler[T]) OnEvent(v T) {
+	h.onSequenceEvent(v, 0)
+}
+
+func (h *collectEventHandler[T]) onSequenceEvent(v T, seq uint64) {
+	h.record("", v, seq)
+}
+
+func (h *collectEventHandler[T]) OnTopicEvent(topic string, v T) {
+	h.record(topic, v, 0)
+}
+
+func (h *collectEventHandler[T]) OnKeyEvent(key string, v T) {
+	h.record(key, v, 0)
+}
+
+func (h *collectEventHandler[T]) record(key string, v T, seq uint64) {
+	if h.check != nil {
+		h.check(v, seq)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, v)
+	h.seqs = append(h.seqs, seq)
+	h.times = append(h.times, time.Now())
+	h.keys = append(h.keys, key)
+}
+
+func (h *collectEventHandler[T]) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.events)
+}
+
+func (h *collectEventHandler[T]) snapshot() []T {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]T(nil), h.events...)
+}
+
+func (h *collectEventHandler[T]) sequences() []uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.seqs...)
+}
+
+func (h *collectEventHandler[T]) timestamps() []time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]time.Time(nil), h.times...)
+}
+
+func (h *collectEventHandler[T]) keySnapshot() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.keys...)
+}
+
+// gateEventHandler 处理第一个事件时关闭entered，并在gate关闭前阻塞处理，
+// 用于模拟处理缓慢的消费端，或者在消费端处理前积压事件
+type gateEventHandler[T any] struct {
+	collectEventHandler[T]
+	entered chan struct{}
+	gate    chan struct{}
+	once    sync.Once
+}
+
+func newGateEventHandler[T any]() *gateEventHandler[T] {
+	return &gateEventHandler[T]{
+		entered: make(chan struct{}),
+		gate:    make(chan struct{}),
+	}
+}
+
+func (h *gateEventHandler[T]) OnEvent(v T) {
+	h.onSequenceEvent(v, 0)
+}
+
+func (h *gateEventHandler[T]) onSequenceEvent(v T, seq uint64) {
+	h.wait()
+	h.collectEventHandler.onSequenceEvent(v, seq)
+}
+
+func (h *gateEventHandler[T]) OnTopicEvent(topic string, v T) {
+	h.wait()
+	h.collectEventHandler.OnTopicEvent(topic, v)
+}
+
+func (h *gateEventHandler[T]) OnKeyEvent(key string, v T) {
+	h.wait()
+	h.collectEventHandler.OnKeyEvent(key, v)
+}
+
+func (h *gateEventHandler[T]) wait() {
+	h.once.Do(func() {
+		close(h.entered)
+	})
+	<-h.gate
+}
+
+// batchEventHandler 将 collectEventHandler 作为批量事件处理器使用，每个批次复制后作为一个事件记录
+type batchEventHandler struct {
+	*collectEventHandler[[]int]
+}
+
+func newBatchEventHandler() batchEventHandler {
+	return batchEventHandler{&collectEventHandler[[]int]{}}
+}
+
+func (h batchEventHandler) Flush(batch []int) {
+	h.OnEvent(append([]int(nil), batch...))
+}
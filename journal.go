@@ -0,0 +1,543 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	journalSuffix         = ".journal"
+	journalHeaderSize     = 16 // 记录头：payload长度(4) + crc32(4) + 序号(8)
+	defaultSegmentSize    = 64 * 1024 * 1024
+	defaultJournalBatch   = 1024
+	journalSegmentNameLen = 20
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// ErrJournalCorrupt 日志记录损坏，通常是进程在写入过程中崩溃导致的尾部记录不完整
+	ErrJournalCorrupt = errors.New("journal record corrupted")
+	// ErrJournalSequence 事件的序号不大于日志中已有的序号，如事件处理器所在的Lockfree未从日志中的序号继续
+	ErrJournalSequence = errors.New("journal sequence is not increasing")
+)
+
+// Codec 事件编解码器，用于将事件持久化到本地文件
+type Codec[T any] interface {
+	// Encode 将事件编码后追加到dst中，返回追加后的切片
+	Encode(dst []byte, v T) ([]byte, error)
+
+	// Decode 从data中解码事件，data在调用结束后会被复用，不能被事件引用
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec 基于encoding/json的编解码器
+type JSONCodec[T any] struct {
+}
+
+func (c JSONCodec[T]) Encode(dst []byte, v T) ([]byte, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, bs...), nil
+}
+
+func (c JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// JournalConfig 日志配置
+type JournalConfig[T any] struct {
+	// Dir 日志文件所在目录，不存在时会自动创建
+	Dir string
+
+	// SegmentSize 单个日志分段的大小（字节），超过后会创建新的分段，默认为64MB
+	SegmentSize int64
+
+	// MaxBatch 单个批次最多缓存的事件数量，达到后会立即落盘，默认为1024
+	MaxBatch int
+
+	// ErrorHandler 编码或写入失败时的处理器，events为该批次中未能持久化的事件，这些事件不会交给下一级处理器
+	// 为nil时会直接panic，以避免在未持久化的情况下继续处理（日志关闭后的写入除外，参考 JournalHandler.Close）
+	ErrorHandler func(err error, events []T)
+}
+
+// journalEvent 等待持久化的事件
+type journalEvent[T any] struct {
+	seq uint64
+	v   T
+}
+
+// journalFile 日志分段文件，由*os.File实现
+type journalFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// JournalHandler 预写日志事件处理器，作为用户事件处理器之前的第一级处理器使用
+// 每个事件及其序号会被编码后追加到本地分段日志文件中，在批次结束（消费端暂时读取不到新的事件）或者
+// 缓存的事件数量达到MaxBatch时统一fsync落盘，落盘成功后才会交给下一级事件处理器，
+// 这样即使进程崩溃，已经被下一级处理器处理过的事件也不会丢失
+// 日志按照大小分段，每个分段以其第一个事件的序号命名；
+// 落盘前会持有事件，因此不支持 WithEventFactory 及 WithRetry，下一级处理器为 Batcher 时会按照其linger刷新
+type JournalHandler[T any] struct {
+	mu       sync.Mutex
+	dir      string
+	codec    Codec[T]
+	next     EventHandler[T]
+	seqNext  sequenceHandler[T]
+	bNext    batchHandler
+	dNext    deadlineHandler
+	segSize  int64
+	maxBatch int
+	errHdl   func(err error, events []T)
+	seq      uint64 // 最后一个写入日志的序号
+	recv     uint64 // 最后一个收到的事件的序号
+	seg      journalFile
+	segLen   int64
+	buf      []byte
+	pending  []journalEvent[T]
+	closed   bool
+}
+
+// NewJournalHandler 创建预写日志事件处理器，next为持久化后继续处理事件的处理器
+// 创建时会扫描已存在的日志分段以获取最后的序号，新的事件总是写入到新的分段中
+func NewJournalHandler[T any](next EventHandler[T], codec Codec[T], config JournalConfig[T]) (*JournalHandler[T], error) {
+	if next == nil || codec == nil || config.Dir == "" {
+		return nil, configError("journal requires next handler, codec and dir")
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = defaultSegmentSize
+	}
+	if config.MaxBatch <= 0 {
+		config.MaxBatch = defaultJournalBatch
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	last, err := lastJournalSeq(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	seqNext := asSequenceHandler[T](next)
+	bNext, _ := next.(batchHandler)
+	dNext, _ := next.(deadlineHandler)
+	return &JournalHandler[T]{
+		dir:      config.Dir,
+		codec:    codec,
+		next:     next,
+		seqNext:  seqNext,
+		bNext:    bNext,
+		dNext:    dNext,
+		segSize:  config.SegmentSize,
+		maxBatch: config.MaxBatch,
+		errHdl:   config.ErrorHandler,
+		seq:      last,
+		recv:     last,
+		pending:  make([]journalEvent[T], 0, config.MaxBatch),
+	}, nil
+}
+
+// OnEvent 未通过Lockfree消费端调用时（无法获取序号），使用最后的序号递增作为事件的序号
+func (j *JournalHandler[T]) OnEvent(v T) {
+	j.onSequenceEvent(v, j.recv+1)
+}
+
+// LastSequence 最后一个写入日志的序号
+func (j *JournalHandler[T]) LastSequence() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// Close 关闭当前的日志分段，需要在Lockfree关闭后调用
+// 消费端关闭时会将缓存的事件落盘，若此时日志已经关闭，这些事件会交给ErrorHandler（未设置时直接丢弃），不会继续处理
+func (j *JournalHandler[T]) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.closed = true
+	if j.seg == nil {
+		return nil
+	}
+	err := j.seg.Close()
+	j.seg = nil
+	return err
+}
+
+func (j *JournalHandler[T]) onSequenceEvent(v T, seq uint64) {
+	if seq <= j.recv {
+		// 序号重复时写入日志会导致回放时出现重复的序号，并可能覆盖已有的分段
+		j.fail(fmt.Errorf("%w: %d after %d", ErrJournalSequence, seq, j.recv), []T{v})
+		return
+	}
+	j.recv = seq
+	var err error
+	if j.buf, err = appendRecord(j.buf, seq, v, j.codec); err != nil {
+		j.fail(err, []T{v})
+		return
+	}
+	j.pending = append(j.pending, journalEvent[T]{seq: seq, v: v})
+	if len(j.pending) >= j.maxBatch {
+		j.flush()
+	}
+}
+
+func (j *JournalHandler[T]) onBatchEnd() {
+	j.flush()
+	if j.bNext != nil {
+		j.bNext.onBatchEnd()
+	}
+}
+
+// deadline 转发下一级处理器的截止时间
+func (j *JournalHandler[T]) deadline() (time.Time, bool) {
+	if j.dNext == nil {
+		return time.Time{}, false
+	}
+	return j.dNext.deadline()
+}
+
+// expire 先将缓存的事件落盘并交给下一级处理器，保证其按照序号处理
+func (j *JournalHandler[T]) expire() {
+	j.flush()
+	if j.dNext != nil {
+		j.dNext.expire()
+	}
+}
+
+func (j *JournalHandler[T]) retain() {}
+
+// flush 将缓存的事件写入日志并fsync，成功后交给下一级处理器
+func (j *JournalHandler[T]) flush() {
+	if len(j.pending) == 0 {
+		return
+	}
+	if err := j.write(); err != nil {
+		events := make([]T, len(j.pending))
+		for i := range j.pending {
+			events[i] = j.pending[i].v
+		}
+		j.reset()
+		j.fail(err, events)
+		return
+	}
+	for _, ev := range j.pending {
+		if j.seqNext != nil {
+			j.seqNext.onSequenceEvent(ev.v, ev.seq)
+		} else {
+			j.next.OnEvent(ev.v)
+		}
+	}
+	j.reset()
+}
+
+func (j *JournalHandler[T]) write() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return ErrClosed
+	}
+	if j.seg == nil || j.segLen >= j.segSize {
+		if err := j.rotate(j.pending[0].seq); err != nil {
+			return err
+		}
+	}
+	if _, err := j.seg.Write(j.buf); err != nil {
+		j.abandon()
+		return err
+	}
+	if err := j.seg.Sync(); err != nil {
+		j.abandon()
+		return err
+	}
+	j.segLen += int64(len(j.buf))
+	j.seq = j.pending[len(j.pending)-1].seq
+	return nil
+}
+
+// abandon 写入失败时放弃当前分段，截断未完整写入的内容后关闭，下一次写入时创建新的分段，
+// 防止之后的记录追加在损坏的内容之后（读取分段时遇到损坏的记录会停止，之后的记录将无法读取）
+func (j *JournalHandler[T]) abandon() {
+	_ = j.seg.Truncate(j.segLen)
+	_ = j.seg.Close()
+	j.seg = nil
+}
+
+// rotate 关闭当前分段并创建以first命名的新分段
+func (j *JournalHandler[T]) rotate(first uint64) error {
+	if j.seg != nil {
+		if err := j.seg.Close(); err != nil {
+			return err
+		}
+		j.seg = nil
+	}
+	// 同名分段可能是之前崩溃时遗留的分段，保留其中的有效记录，只截断尾部不完整的记录，之后继续追加
+	path := filepath.Join(j.dir, journalSegmentName(first))
+	valid, err := scanJournalSegment(path, func(seq uint64, payload []byte) error {
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrJournalCorrupt) && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(valid); err == nil {
+		_, err = f.Seek(valid, io.SeekStart)
+	}
+	// 同步目录，保证新创建的分段文件在崩溃后仍然存在
+	if err == nil {
+		err = syncDir(j.dir)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.seg = f
+	j.segLen = valid
+	return nil
+}
+
+func (j *JournalHandler[T]) reset() {
+	var zero journalEvent[T]
+	for i := range j.pending {
+		// 释放事件的引用
+		j.pending[i] = zero
+	}
+	j.pending = j.pending[:0]
+	j.buf = j.buf[:0]
+}
+
+func (j *JournalHandler[T]) fail(err error, events []T) {
+	if j.errHdl != nil {
+		j.errHdl(err, events)
+		return
+	}
+	if !errors.Is(err, ErrClosed) {
+		panic(fmt.Errorf("journal: %w", err))
+	}
+}
+
+// replay 读取日志中序号不小于from的事件，并交给下一级事件处理器处理（不会再次写入日志）
+// 返回日志中最后一个事件的序号
+func (j *JournalHandler[T]) replay(from uint64) (uint64, error) {
+	segs, err := journalSegments(j.dir)
+	if err != nil {
+		return 0, err
+	}
+	var last uint64
+	for i, seg := range segs {
+		// 后一个分段的起始序号不大于from时，该分段中的事件均不需要回放
+		if i+1 < len(segs) && segs[i+1].first <= from {
+			continue
+		}
+		err = readJournalSegment(seg.path, func(seq uint64, payload []byte) error {
+			last = seq
+			if seq < from {
+				return nil
+			}
+			v, err := j.codec.Decode(payload)
+			if err != nil {
+				return fmt.Errorf("decode journal record %d: %w", seq, err)
+			}
+			if j.seqNext != nil {
+				j.seqNext.onSequenceEvent(v, seq)
+			} else {
+				j.next.OnEvent(v)
+			}
+			return nil
+		})
+		// 损坏的记录只会出现在崩溃时正在写入的分段尾部，之后的记录位于新的分段中
+		if err != nil && !errors.Is(err, ErrJournalCorrupt) {
+			return 0, err
+		}
+	}
+	if j.bNext != nil {
+		j.bNext.onBatchEnd()
+	}
+	if last < j.seq {
+		last = j.seq
+	}
+	return last, nil
+}
+
+func journalSegmentName(first uint64) string {
+	return fmt.Sprintf("%0*d%s", journalSegmentNameLen, first, journalSuffix)
+}
+
+// journalSegment 日志分段
+type journalSegment struct {
+	first uint64 // 分段中第一个事件的序号
+	path  string
+}
+
+// journalSegments 获取目录下所有的日志分段，按照序号升序排列
+func journalSegments(dir string) ([]journalSegment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []journalSegment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, journalSuffix) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, journalSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segs = append(segs, journalSegment{first: first, path: filepath.Join(dir, name)})
+	}
+	sort.Slice(segs, func(i, k int) bool {
+		return segs[i].first < segs[k].first
+	})
+	return segs, nil
+}
+
+// readJournalSegment 按顺序读取分段中的记录，遇到不完整或者损坏的记录时停止并返回 ErrJournalCorrupt
+func readJournalSegment(path string, fn func(seq uint64, payload []byte) error) error {
+	_, err := scanJournalSegment(path, fn)
+	return err
+}
+
+// scanJournalSegment 与 readJournalSegment 一致，同时返回有效记录的总长度
+func scanJournalSegment(path string, fn func(seq uint64, payload []byte) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	var buf []byte
+	var valid int64
+	for {
+		var seq uint64
+		var payload []byte
+		seq, payload, buf, err = readRecord(r, buf, info.Size()-valid-journalHeaderSize)
+		if err != nil {
+			if err == io.EOF {
+				return valid, nil
+			}
+			return valid, err
+		}
+		if err = fn(seq, payload); err != nil {
+			return valid, err
+		}
+		valid += int64(journalHeaderSize + len(payload))
+	}
+}
+
+// appendRecord 将事件编码为记录追加到dst中，记录格式为：payload长度(4) + crc32(4) + 序号(8) + payload
+// 其中crc32覆盖序号及payload，编码失败时返回原始的dst
+func appendRecord[T any](dst []byte, seq uint64, v T, codec Codec[T]) ([]byte, error) {
+	start := len(dst)
+	dst = append(dst, make([]byte, journalHeaderSize)...)
+	dst, err := codec.Encode(dst, v)
+	if err != nil {
+		return dst[:start], err
+	}
+	record := dst[start:]
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(record)-journalHeaderSize))
+	setRecordSeq(record, seq)
+	return dst, nil
+}
+
+// setRecordSeq 修改记录中的序号并重新计算crc32
+func setRecordSeq(record []byte, seq uint64) {
+	binary.LittleEndian.PutUint64(record[8:16], seq)
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(record[8:], crcTable))
+}
+
+// readRecord 读取一条记录，buf为可复用的缓冲区，返回的payload引用该缓冲区
+// limit为payload长度的上限（如文件中剩余的字节数），防止根据损坏的记录头申请过大的内存
+// 没有任何数据时返回io.EOF，记录不完整或者校验失败时返回 ErrJournalCorrupt
+func readRecord(r *bufio.Reader, buf []byte, limit int64) (uint64, []byte, []byte, error) {
+	if cap(buf) < journalHeaderSize {
+		buf = make([]byte, journalHeaderSize, 256)
+	}
+	header := buf[:journalHeaderSize]
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return 0, nil, buf, err
+		}
+		return 0, nil, buf, ErrJournalCorrupt
+	}
+	if int64(binary.LittleEndian.Uint32(header[0:4])) > limit {
+		return 0, nil, buf, ErrJournalCorrupt
+	}
+	size := int(binary.LittleEndian.Uint32(header[0:4]))
+	if cap(buf) < journalHeaderSize+size {
+		buf = append(buf[:journalHeaderSize], make([]byte, size)...)
+		header = buf[:journalHeaderSize]
+	}
+	record := buf[:journalHeaderSize+size]
+	if _, err := io.ReadFull(r, record[journalHeaderSize:]); err != nil {
+		return 0, nil, buf, ErrJournalCorrupt
+	}
+	if crc32.Checksum(record[8:], crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return 0, nil, buf, ErrJournalCorrupt
+	}
+	return binary.LittleEndian.Uint64(header[8:16]), record[journalHeaderSize:], buf, nil
+}
+
+// lastJournalSeq 获取目录下日志中最后一个有效记录的序号，没有记录时返回0
+func lastJournalSeq(dir string) (uint64, error) {
+	segs, err := journalSegments(dir)
+	if err != nil {
+		return 0, err
+	}
+	// 最后的分段可能为空（创建后尚未写入即崩溃），因此从后往前查找
+	for i := len(segs) - 1; i >= 0; i-- {
+		var last uint64
+		err = readJournalSegment(segs[i].path, func(seq uint64, payload []byte) error {
+			last = seq
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrJournalCorrupt) {
+			return 0, err
+		}
+		if last > 0 {
+			return last, nil
+		}
+	}
+	return 0, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
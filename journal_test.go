@@ -0,0 +1,271 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type journalEntry struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
+}
+
+// durable 校验事件在处理前已经落盘
+func durable(t *testing.T, journal *JournalHandler[journalEntry]) func(v journalEntry, seq uint64) {
+	return func(v journalEntry, seq uint64) {
+		assert.GreaterOrEqual(t, journal.LastSequence(), seq)
+		assert.Equal(t, seq, v.ID)
+	}
+}
+
+func readJournal(t *testing.T, dir string) []journalEntry {
+	segs, err := journalSegments(dir)
+	assert.NoError(t, err)
+	var entries []journalEntry
+	codec := JSONCodec[journalEntry]{}
+	for _, seg := range segs {
+		err = readJournalSegment(seg.path, func(seq uint64, payload []byte) error {
+			v, err := codec.Decode(payload)
+			assert.Equal(t, seq, v.ID)
+			entries = append(entries, v)
+			return err
+		})
+		assert.NoError(t, err)
+	}
+	return entries
+}
+
+func TestJournalHandler(t *testing.T) {
+	dir := t.TempDir()
+	eh := &collectEventHandler[journalEntry]{}
+	journal, err := NewJournalHandler[journalEntry](eh, JSONCodec[journalEntry]{}, JournalConfig[journalEntry]{
+		Dir:         dir,
+		SegmentSize: 1024,
+		MaxBatch:    16,
+	})
+	assert.NoError(t, err)
+	eh.check = durable(t, journal)
+	lf, err := New[journalEntry](journal, WithCapacity(64))
+	assert.NoError(t, err)
+	assert.NoError(t, lf.Start())
+	total := 500
+	for i := 1; i <= total; i++ {
+		assert.NoError(t, lf.Producer().Write(journalEntry{ID: uint64(i), Name: "entry"}))
+	}
+	assert.Eventually(t, func() bool {
+		return eh.count() == total
+	}, 5*time.Second, time.Millisecond)
+	assert.NoError(t, lf.Close())
+	assert.NoError(t, journal.Close())
+
+	// 按照大小进行了分段
+	segs, err := journalSegments(dir)
+	assert.NoError(t, err)
+	assert.Greater(t, len(segs), 1)
+	assert.Equal(t, uint64(1), segs[0].first)
+	entries := readJournal(t, dir)
+	assert.Equal(t, total, len(entries))
+	for i, entry := range entries {
+		assert.Equal(t, uint64(i+1), entry.ID)
+	}
+
+	// 尾部写入不完整的记录后重新打开，序号从最后一个有效记录继续
+	f, err := os.OpenFile(segs[len(segs)-1].path, os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{10, 0, 0, 0, 1, 2, 3})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	reopened, err := NewJournalHandler[journalEntry](eh, JSONCodec[journalEntry]{}, JournalConfig[journalEntry]{Dir: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(total), reopened.LastSequence())
+	assert.NoError(t, reopened.Close())
+}
+
+type badCodec struct {
+	JSONCodec[journalEntry]
+}
+
+func (c badCodec) Encode(dst []byte, v journalEntry) ([]byte, error) {
+	if v.ID%2 == 0 {
+		return dst, errors.New("bad entry")
+	}
+	return c.JSONCodec.Encode(dst, v)
+}
+
+func TestJournalHandlerError(t *testing.T) {
+	eh := &collectEventHandler[journalEntry]{}
+	var failed []journalEntry
+	journal, err := NewJournalHandler[journalEntry](eh, badCodec{}, JournalConfig[journalEntry]{
+		Dir: t.TempDir(),
+		ErrorHandler: func(err error, events []journalEntry) {
+			failed = append(failed, events...)
+		},
+	})
+	assert.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		journal.OnEvent(journalEntry{ID: uint64(i)})
+	}
+	journal.onBatchEnd()
+	assert.Equal(t, []journalEntry{{ID: 1}, {ID: 3}}, eh.snapshot())
+	assert.Equal(t, []journalEntry{{ID: 2}, {ID: 4}}, failed)
+	assert.Equal(t, uint64(3), journal.LastSequence())
+	assert.NoError(t, journal.Close())
+
+	_, err = NewJournalHandler[journalEntry](nil, badCodec{}, JournalConfig[journalEntry]{Dir: t.TempDir()})
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+// failingFile 只写入一半的内容后返回错误，模拟磁盘写满等情况
+type failingFile struct {
+	*os.File
+}
+
+func (f failingFile) Write(p []byte) (int, error) {
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, errors.New("disk full")
+}
+
+func TestJournalHandlerWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	eh := &collectEventHandler[journalEntry]{}
+	var failed []journalEntry
+	journal, err := NewJournalHandler[journalEntry](eh, JSONCodec[journalEntry]{}, JournalConfig[journalEntry]{
+		Dir: dir,
+		ErrorHandler: func(err error, events []journalEntry) {
+			failed = append(failed, events...)
+		},
+	})
+	assert.NoError(t, err)
+	batch := func(ids ...uint64) {
+		for _, id := range ids {
+			journal.OnEvent(journalEntry{ID: id})
+		}
+		journal.onBatchEnd()
+	}
+	batch(1, 2)
+	journal.seg = failingFile{File: journal.seg.(*os.File)}
+	batch(3, 4)
+	// 写入失败后放弃当前分段，之后的记录写入新的分段
+	batch(5, 6)
+	assert.Equal(t, []journalEntry{{ID: 1}, {ID: 2}, {ID: 5}, {ID: 6}}, eh.snapshot())
+	assert.Equal(t, []journalEntry{{ID: 3}, {ID: 4}}, failed)
+	assert.Equal(t, uint64(6), journal.LastSequence())
+	assert.NoError(t, journal.Close())
+
+	// 未完整写入的内容已被截断，重新打开后可以读取到之后的记录
+	entries := readJournal(t, dir)
+	assert.Equal(t, []journalEntry{{ID: 1}, {ID: 2}, {ID: 5}, {ID: 6}}, entries)
+	reopened, err := NewJournalHandler[journalEntry](eh, JSONCodec[journalEntry]{}, JournalConfig[journalEntry]{Dir: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(6), reopened.LastSequence())
+	assert.NoError(t, reopened.Close())
+}
+
+func TestJournalHandlerExistingSegment(t *testing.T) {
+	dir := t.TempDir()
+	eh := &collectEventHandler[journalEntry]{}
+	config := JournalConfig[journalEntry]{Dir: dir}
+	journal, err := NewJournalHandler[journalEntry](eh, JSONCodec[journalEntry]{}, config)
+	assert.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		journal.OnEvent(journalEntry{ID: uint64(i)})
+	}
+	journal.onBatchEnd()
+	assert.NoError(t, journal.Close())
+
+	// 尾部为损坏的记录头，其中的长度远大于文件的大小
+	segs, err := journalSegments(dir)
+	assert.NoError(t, err)
+	f, err := os.OpenFile(segs[0].path, os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13})
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	var errs []error
+	config.ErrorHandler = func(err error, events []journalEntry) {
+		errs = append(errs, err)
+	}
+	journal, err = NewJournalHandler[journalEntry](eh, JSONCodec[journalEntry]{}, config)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), journal.LastSequence())
+	// 序号未从日志中的序号继续时拒绝写入
+	journal.onSequenceEvent(journalEntry{ID: 1}, 1)
+	journal.onBatchEnd()
+	if assert.Len(t, errs, 1) {
+		assert.ErrorIs(t, errs[0], ErrJournalSequence)
+	}
+	// 打开已有记录的同名分段时保留有效记录，只截断损坏的尾部
+	assert.NoError(t, journal.rotate(1))
+	journal.OnEvent(journalEntry{ID: 4})
+	journal.onBatchEnd()
+	assert.NoError(t, journal.Close())
+	assert.Equal(t, []journalEntry{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}, readJournal(t, dir))
+}
+
+// runJournal 使用预写日志运行一次Lockfree，回放from之后的事件后再写入count个事件，返回处理器收到的所有序号
+func runJournal(t *testing.T, dir string, from uint64, count int) []uint64 {
+	eh := &collectEventHandler[journalEntry]{}
+	journal, err := NewJournalHandler[journalEntry](eh, JSONCodec[journalEntry]{}, JournalConfig[journalEntry]{
+		Dir:         dir,
+		SegmentSize: 512,
+	})
+	assert.NoError(t, err)
+	eh.check = durable(t, journal)
+	lf, err := New[journalEntry](journal, WithCapacity(16))
+	assert.NoError(t, err)
+	if from > 0 {
+		assert.NoError(t, lf.Replay(from))
+	}
+	replayed := eh.count()
+	assert.NoError(t, lf.Start())
+	assert.ErrorIs(t, lf.Replay(from), ErrAlreadyStarted)
+	last := journal.LastSequence()
+	for i := 1; i <= count; i++ {
+		assert.NoError(t, lf.Producer().Write(journalEntry{ID: last + uint64(i)}))
+	}
+	assert.Eventually(t, func() bool {
+		return eh.count() == replayed+count
+	}, 5*time.Second, time.Millisecond)
+	assert.NoError(t, lf.Close())
+	assert.NoError(t, journal.Close())
+	return eh.sequences()
+}
+
+func TestLockfreeReplay(t *testing.T) {
+	dir := t.TempDir()
+	seqs := runJournal(t, dir, 0, 100)
+	assert.Equal(t, uint64(1), seqs[0])
+	assert.Equal(t, uint64(100), seqs[99])
+
+	// 回放全部事件后序号从101继续
+	seqs = runJournal(t, dir, 1, 10)
+	assert.Equal(t, 110, len(seqs))
+	for i, seq := range seqs {
+		assert.Equal(t, uint64(i+1), seq)
+	}
+
+	// 仅回放50之后的事件
+	seqs = runJournal(t, dir, 50, 0)
+	assert.Equal(t, 61, len(seqs))
+	assert.Equal(t, uint64(50), seqs[0])
+	assert.Equal(t, uint64(110), seqs[60])
+
+	// 不回放时序号同样从日志中最后一个事件的序号继续
+	seqs = runJournal(t, dir, 0, 5)
+	assert.Equal(t, []uint64{111, 112, 113, 114, 115}, seqs)
+
+	lf := NewLockfree[uint64](16, &countEventHandler[uint64]{}, NewChanBlockStrategy())
+	assert.ErrorIs(t, lf.Replay(1), ErrUnsupported)
+}
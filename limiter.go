@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// limitPoll 等待在途事件被读取时的检查间隔
+const limitPoll = 100 * time.Microsecond
+
+// Limiter 生产者的准入控制配置，通过 Producer.WithLimiter 使用
+type Limiter struct {
+	Rate     float64       // 每秒允许写入的事件数量，为0时不限制速率
+	Burst    int           // 允许的突发数量（令牌桶的容量），Rate大于0时需要大于0
+	InFlight int           // 已写入但尚未被消费端读取的事件数量上限，为0时不限制
+	MaxWait  time.Duration // 超过限制时最多等待的时间，为0时直接返回 ErrThrottled
+}
+
+// LimitedProducer 带有准入控制的生产者，由 Producer.WithLimiter 创建，与原生产者写入同一个buffer，
+// 超过速率或者在途数量的限制时最多等待 Limiter.MaxWait，之后返回 ErrThrottled，而不是一直等待buffer中的位置，
+// 可以为每个租户创建各自的LimitedProducer，防止单个租户写满共享的buffer
+type LimitedProducer[T any] struct {
+	q         *Producer[T]
+	limiter   Limiter
+	mu        sync.Mutex
+	bucket    *tokenBucket // 速率限制，Rate为0时为nil
+	seqs      []uint64     // 已写入但可能尚未被读取的序号
+	reserved  int          // 已通过准入但尚未写入完成的数量
+	throttled uint64       // 返回 ErrThrottled 的次数
+}
+
+// WithLimiter 基于当前生产者创建带有准入控制的生产者，配置不合法时返回 ErrInvalidConfig
+func (q *Producer[T]) WithLimiter(limiter Limiter) (*LimitedProducer[T], error) {
+	if limiter.Rate < 0 || (limiter.Rate > 0 && limiter.Burst < 1) {
+		return nil, configError("limiter requires non-negative rate and positive burst")
+	}
+	if limiter.InFlight < 0 || limiter.MaxWait < 0 {
+		return nil, configError("limiter requires non-negative in-flight budget and max wait")
+	}
+	p := &LimitedProducer[T]{
+		q:       q,
+		limiter: limiter,
+	}
+	if limiter.Rate > 0 {
+		p.bucket = newTokenBucket(&rateLimit{rate: limiter.Rate, burst: limiter.Burst})
+	}
+	return p, nil
+}
+
+// Write 写入对象，超过限制且等待 Limiter.MaxWait 后仍超过限制时返回 ErrThrottled；
+// 通过准入后与 Producer.Write 一致，buffer写满时仍会等待
+func (p *LimitedProducer[T]) Write(v T) error {
+	if p.q.closed() {
+		return writeError(p.q.name, 0, ErrClosed)
+	}
+	if !p.admit() {
+		if p.q.closed() {
+			return writeError(p.q.name, 0, ErrClosed)
+		}
+		atomic.AddUint64(&p.throttled, 1)
+		return writeError(p.q.name, 0, ErrThrottled)
+	}
+	seq, err := p.q.write(v)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reserved--
+	if err == nil && p.limiter.InFlight > 0 {
+		p.seqs = append(p.seqs, seq)
+	}
+	return err
+}
+
+// InFlight 已写入但尚未被消费端读取的事件数量（包含正在写入的事件），未设置在途数量限制时为0
+func (p *LimitedProducer[T]) InFlight() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune()
+	return len(p.seqs) + p.reserved
+}
+
+// Throttled 返回 ErrThrottled 的次数
+func (p *LimitedProducer[T]) Throttled() uint64 {
+	return atomic.LoadUint64(&p.throttled)
+}
+
+// admit 判断是否允许写入，超过限制时最多等待 Limiter.MaxWait
+func (p *LimitedProducer[T]) admit() bool {
+	deadline := time.Now().Add(p.limiter.MaxWait)
+	for {
+		wait := p.reserve()
+		if wait == 0 {
+			return true
+		}
+		now := time.Now()
+		if !now.Before(deadline) || p.q.closed() {
+			return false
+		}
+		if remain := deadline.Sub(now); wait > remain {
+			wait = remain
+		}
+		time.Sleep(wait)
+	}
+}
+
+// reserve 检查在途数量及速率，均未超过限制时占用一个名额并返回0，否则返回建议等待的时间
+func (p *LimitedProducer[T]) reserve() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.limiter.InFlight > 0 {
+		p.prune()
+		if len(p.seqs)+p.reserved >= p.limiter.InFlight {
+			return limitPoll
+		}
+	}
+	if p.bucket != nil {
+		if wait := p.bucket.reserve(time.Now()); wait > 0 {
+			return wait
+		}
+	}
+	p.reserved++
+	return 0
+}
+
+// prune 移除已被读取的序号，读取游标不由消费端直接维护时（如广播）先刷新读取游标
+func (p *LimitedProducer[T]) prune() {
+	if p.q.gate != nil {
+		p.q.gate()
+	}
+	rc := p.q.seqer.nextRead()
+	n := 0
+	for _, seq := range p.seqs {
+		if seq >= rc {
+			p.seqs[n] = seq
+			n++
+		}
+	}
+	p.seqs = p.seqs[:n]
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterInFlight(t *testing.T) {
+	h := newGateEventHandler[int]()
+	l, err := New[int](h, WithCapacity(16))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	p, err := l.Producer().WithLimiter(Limiter{InFlight: 2})
+	assert.NoError(t, err)
+	// 第一个事件被读取后消费端阻塞，之后的事件均在途
+	assert.NoError(t, p.Write(0))
+	<-h.entered
+	assert.NoError(t, p.Write(1))
+	assert.NoError(t, p.Write(2))
+	assert.Equal(t, 2, p.InFlight())
+	assert.ErrorIs(t, p.Write(3), ErrThrottled)
+	assert.Equal(t, uint64(1), p.Throttled())
+	// 不受限制的生产者仍然可以写入
+	assert.NoError(t, l.Producer().Write(4))
+
+	close(h.gate)
+	assert.Eventually(t, func() bool {
+		return p.InFlight() == 0
+	}, 5*time.Second, time.Millisecond)
+	assert.NoError(t, p.Write(5))
+	assert.Eventually(t, func() bool {
+		return h.count() == 5
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []int{0, 1, 2, 4, 5}, h.snapshot())
+}
+
+func TestLimiterRate(t *testing.T) {
+	h := &countEventHandler[int]{}
+	l, err := New[int](h)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	p, err := l.Producer().WithLimiter(Limiter{Rate: 50, Burst: 2})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Write(1))
+	assert.NoError(t, p.Write(2))
+	assert.ErrorIs(t, p.Write(3), ErrThrottled)
+
+	// 等待下一个令牌
+	p, err = l.Producer().WithLimiter(Limiter{Rate: 50, Burst: 1, MaxWait: time.Second})
+	assert.NoError(t, err)
+	start := time.Now()
+	assert.NoError(t, p.Write(1))
+	assert.NoError(t, p.Write(2))
+	assert.True(t, time.Since(start) >= 15*time.Millisecond)
+}
+
+func TestLimiterConfig(t *testing.T) {
+	l, err := New[int](&countEventHandler[int]{})
+	assert.NoError(t, err)
+	_, err = l.Producer().WithLimiter(Limiter{Rate: 10})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = l.Producer().WithLimiter(Limiter{InFlight: -1})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	p, err := l.Producer().WithLimiter(Limiter{})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, p.Write(1), ClosedError)
+}
+
+func TestLimiterInFlightBroadcast(t *testing.T) {
+	b, err := NewBroadcast[int](WithCapacity(16))
+	assert.NoError(t, err)
+	assert.NoError(t, b.Start())
+	defer b.Close()
+	h := &collectEventHandler[int]{}
+	_, err = b.Subscribe(h)
+	assert.NoError(t, err)
+
+	p, err := b.Producer().WithLimiter(Limiter{InFlight: 2})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Write(1))
+	assert.NoError(t, p.Write(2))
+	// 广播的读取游标由订阅者的读取游标刷新，订阅者读取后不再在途
+	assert.Eventually(t, func() bool {
+		return p.InFlight() == 0
+	}, 5*time.Second, time.Millisecond)
+	assert.NoError(t, p.Write(3))
+	assert.Eventually(t, func() bool {
+		return len(h.snapshot()) == 3
+	}, 5*time.Second, time.Millisecond)
+}
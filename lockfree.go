@@ -9,30 +9,156 @@ package lockfree
 
 import (
 	"fmt"
+	"math/bits"
 	"sync/atomic"
+	"time"
+	"unsafe"
 )
 
 // Lockfree 包装类，内部包装了生产者和消费者
 type Lockfree[T any] struct {
+	name     string
 	writer   *Producer[T]
 	consumer *consumer[T]
+	journal  *JournalHandler[T] // 事件处理器为预写日志处理器时，用于回放
 	status   int32
 }
 
+// Stats Lockfree的运行统计，由于执行时不加锁，该结果是不可靠的
+type Stats struct {
+	Written       uint64        // 最后一个已获取的写入序号，包含正在写入的事件
+	Consumed      uint64        // 最后一个已读取的序号
+	Pending       uint64        // 尚未读取的事件数量
+	Throttled     bool          // 消费端当前是否因限流而暂停，参考 WithRateLimit
+	ThrottleWaits uint64        // 消费端因限流而暂停的次数
+	ThrottleTime  time.Duration // 消费端因限流而暂停的总时间
+	Stalls        uint64        // 消费端发生停滞的次数，参考 WithStallWatchdog
+	Skipped       uint64        // 因停滞而跳过的序号数量
+}
+
+// New 通过配置项创建Lockfree，配置不合法时返回 ErrInvalidConfig
+// handler：消费端的事件处理器，不能为nil
+// opts：配置项，参考 WithCapacity、WithWaitStrategy、WithProducerType、WithExceptionHandler、WithName 等
+func New[T any](handler EventHandler[T], opts ...Option) (*Lockfree[T], error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := checkOptions[T](handler, o); err != nil {
+		return nil, err
+	}
+	if o.weights != nil {
+		return nil, configError("lane weights are only supported by priority lockfree")
+	}
+	if _, ok := handler.(*JournalHandler[T]); ok && (o.retry != nil || o.deadLetter != nil) {
+		return nil, configError("retry and dead letter are not supported by journal handler")
+	}
+	if _, ok := handler.(*JournalHandler[T]); ok && o.stall != nil && o.stall.Skip {
+		return nil, configError("stall skip is not supported by journal handler")
+	}
+	// 重新计算正确的容量，前面已校验，此处不会出错
+	o.capacity, _ = NextPowerOfTwo(o.capacity)
+	var spill *spillQueue[T]
+	if o.spill != nil {
+		var err error
+		if spill, err = newSpillQueue(o.spill.(*spillConfig[T])); err != nil {
+			return nil, err
+		}
+	}
+	return newLockfree[T](handler, o, spill), nil
+}
+
+// EstimateMemory 估算指定容量的Lockfree占用的内存大小（字节），容量会按照 New 的规则调整为2^n
+// 仅计算buffer及内部结构体本身的大小，事件中指针、切片等引用的内存不包含在内
+func EstimateMemory[T any](capacity int) (uint64, error) {
+	n, err := NextPowerOfTwo(capacity)
+	if err != nil {
+		return 0, err
+	}
+	hi, size := bits.Mul64(uint64(unsafe.Sizeof(e[T]{})), uint64(n))
+	if hi != 0 {
+		return 0, configError("memory of capacity %d overflows uint64", capacity)
+	}
+	size += uint64(unsafe.Sizeof(Lockfree[T]{}) + unsafe.Sizeof(Producer[T]{}) + unsafe.Sizeof(consumer[T]{}) +
+		unsafe.Sizeof(ringBuffer[T]{}) + unsafe.Sizeof(sequencer{}) + unsafe.Sizeof(cursor{}) +
+		unsafe.Sizeof(sharedBlockStrategy{}))
+	return size, nil
+}
+
 // NewLockfree 自定义创建消费端的Disruptor
 // capacity：buffer的容量大小，类似于chan的大小，但要求必须是2^n，即2的指数倍，如果不是的话会被修改
 // handler：消费端的事件处理器
-// blocks：读取阻塞时的处理策略
+// blocks：读取阻塞时的处理策略，同时也决定了buffer写满时生产者的等待方式
+// 该方法不会对参数进行校验，推荐使用 New
 func NewLockfree[T any](capacity int, handler EventHandler[T], blocks blockStrategy) *Lockfree[T] {
-	// 重新计算正确的容量
-	capacity = minSuitableCap(capacity)
-	seqer := newSequencer(capacity)
-	rbuf := newRingBuffer[T](capacity)
-	cmer := newConsumer[T](rbuf, handler, seqer, blocks)
-	writer := newProducer[T](seqer, rbuf, blocks)
+	return NewLockfreeWithFactory[T](capacity, handler, blocks, nil)
+}
+
+// NewLockfreeWithFactory 创建带有事件工厂的Disruptor，创建时会使用factory预先填充buffer中的每个位置
+// 此时消费端会在事件处理完成后才释放对应位置，以保证处理过程中该位置上的对象不会被生产者修改，
+// 若handler实现了 EventClearer 接口，则会在释放前调用 Clear 清理该对象
+// factory为nil时与 NewLockfree 一致
+func NewLockfreeWithFactory[T any](capacity int, handler EventHandler[T], blocks blockStrategy, factory EventFactory[T]) *Lockfree[T] {
+	o := &options{
+		name:         defaultName,
+		capacity:     minSuitableCap(capacity),
+		blocks:       blocks,
+		producerType: ProducerMulti,
+	}
+	if factory != nil {
+		o.factory = factory
+	}
+	return newLockfree[T](handler, o, nil)
+}
+
+// newLockfree 根据配置创建Lockfree，配置需提前校验，spill为nil时表示不使用溢出模式
+func newLockfree[T any](handler EventHandler[T], o *options, spill *spillQueue[T]) *Lockfree[T] {
+	seqer := newSequencer(o.capacity)
+	rbuf := newRingBuffer[T](o.capacity)
+	factory, _ := o.factory.(EventFactory[T])
+	if factory != nil {
+		rbuf.fill(factory)
+	}
+	exception, _ := o.exception.(ExceptionHandler[T])
+	pblocks := newSharedBlockStrategy(o.blocks)
+	journal, _ := handler.(*JournalHandler[T])
+	var sched *scheduler[T]
+	if journal == nil {
+		// 定时事件没有序号，无法写入预写日志
+		sched = newScheduler[T]()
+	}
+	var cmer *consumer[T]
+	wake := &alarm{}
+	// 溢出及定时的事件不会写入buffer，消费端阻塞时还需要判断是否有这些事件
+	blocks := newReadyBlockStrategy(o.blocks, func() bool {
+		return (spill != nil && spill.size() > 0) || (sched != nil && sched.ready()) || wake.ready() || cmer.closed()
+	})
+	wake.release = blocks.release
+	cmer = newConsumer[T](rbuf, handler, seqer, blocks, pblocks, factory != nil, exception)
+	cmer.spill = spill
+	cmer.sched = sched
+	cmer.wake = wake
+	cmer.retry = o.retry
+	cmer.limiter = newTokenBucket(o.rateLimit)
+	cmer.dead, _ = o.deadLetter.(deadLetterFunc[T])
+	writer := newProducer[T](seqer, rbuf, blocks, pblocks, o.producerType == ProducerSingle)
+	writer.name = o.name
+	writer.spill = spill
+	writer.sched = sched
+	cmer.stall = newStallWatch(o.stall, writer.skip)
+	cmer.mark = newWatermark(o.watermarks, rbuf.cap())
+	if sched != nil {
+		sched.release = blocks.release
+	}
+	if journal != nil {
+		// 序号从日志中最后一个事件的序号继续，保证日志中的序号不会重复
+		seqer.continueFrom(journal.LastSequence())
+	}
 	return &Lockfree[T]{
+		name:     o.name,
 		writer:   writer,
 		consumer: cmer,
+		journal:  journal,
 		status:   READY,
 	}
 }
@@ -53,7 +179,32 @@ func (d *Lockfree[T]) Start() error {
 		}
 		return nil
 	}
-	return fmt.Errorf(StartErrorFormat, "Disruptor")
+	return startError(d.name)
+}
+
+// Replay 从预写日志中回放序号不小于from的事件，事件会交给 JournalHandler 的下一级事件处理器处理，用于重启后重建内存状态
+// 需要事件处理器为 JournalHandler，并且在 Start 之前、未写入任何数据时调用
+// 回放完成后，序号会从日志中最后一个事件的序号继续，而不是重新从1开始
+func (d *Lockfree[T]) Replay(from uint64) error {
+	if d.journal == nil {
+		return replayError(d.name, fmt.Errorf("%w without journal handler", ErrUnsupported))
+	}
+	seqer := d.writer.seqer
+	last := d.journal.LastSequence()
+	if atomic.LoadInt32(&d.status) != READY || seqer.wc.atomicLoad() != last || seqer.nextRead() != last+1 {
+		return replayError(d.name, fmt.Errorf("%w, replay must be called before start and any write", ErrAlreadyStarted))
+	}
+	last, err := d.journal.replay(from)
+	if err != nil {
+		return replayError(d.name, err)
+	}
+	seqer.continueFrom(last)
+	return nil
+}
+
+// Stats 获取运行统计
+func (d *Lockfree[T]) Stats() Stats {
+	return d.consumer.stats()
 }
 
 func (d *Lockfree[T]) Producer() *Producer[T] {
@@ -81,5 +232,5 @@ func (d *Lockfree[T]) Close() error {
 		// 关闭成功
 		return nil
 	}
-	return fmt.Errorf(CloseErrorFormat, "Disruptor")
+	return closeError(d.name)
 }
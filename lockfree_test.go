@@ -8,10 +8,13 @@
 package lockfree
 
 import (
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func BenchmarkLockFree(b *testing.B) {
@@ -101,4 +104,228 @@ func TestCondBlockStrategy(t *testing.T) {
 	wg.Wait()
 	time.Sleep(time.Second * 1)
 	disruptor.Close()
-}
\ No newline at end of file
+}
+
+func TestProducerBlockWhenFull(t *testing.T) {
+	var (
+		goS   = 100
+		perGo = 100
+	)
+	for _, blocks := range []blockStrategy{NewChanBlockStrategy(), NewConditionBlockStrategy(), NewSleepBlockStrategy(time.Microsecond)} {
+		eh := &countEventHandler[uint64]{}
+		disruptor := NewLockfree[uint64](2, eh, blocks)
+		assert.NoError(t, disruptor.Start())
+		producer := disruptor.Producer()
+		var wg sync.WaitGroup
+		wg.Add(goS)
+		for i := 0; i < goS; i++ {
+			go func() {
+				defer wg.Done()
+				for j := 0; j < perGo; j++ {
+					assert.NoError(t, producer.Write(uint64(j)))
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Eventually(t, func() bool {
+			return eh.load() == int64(goS*perGo)
+		}, 5*time.Second, time.Millisecond)
+		assert.NoError(t, disruptor.Close())
+	}
+}
+
+// countBlockStrategy 休眠等待，并记录在指定游标上阻塞的次数
+type countBlockStrategy struct {
+	SleepBlockStrategy
+	target *uint64
+	count  int64
+}
+
+func (s *countBlockStrategy) block(actual *uint64, expected uint64) {
+	if actual == s.target {
+		atomic.AddInt64(&s.count, 1)
+	}
+	s.SleepBlockStrategy.block(actual, expected)
+}
+
+func TestProducerBlockWithStrategy(t *testing.T) {
+	h := newGateEventHandler[int]()
+	blocks := &countBlockStrategy{SleepBlockStrategy: SleepBlockStrategy{t: time.Millisecond}}
+	l, err := New[int](h, WithCapacity(2), WithWaitStrategy(blocks))
+	assert.NoError(t, err)
+	blocks.target = &l.writer.seqer.rc
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	// 第一个事件被读取后消费端阻塞，之后写满buffer，最后一个生产者按照用户传入的策略等待
+	p := l.Producer()
+	assert.NoError(t, p.Write(0))
+	<-h.entered
+	assert.NoError(t, p.Write(1))
+	assert.NoError(t, p.Write(2))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, p.Write(3))
+	}()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&blocks.count) > 0
+	}, 5*time.Second, time.Millisecond)
+	close(h.gate)
+	<-done
+	assert.Eventually(t, func() bool {
+		return h.count() == 4
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestTryWriteTimeoutBlockWithStrategy(t *testing.T) {
+	h := newGateEventHandler[int]()
+	blocks := &countBlockStrategy{SleepBlockStrategy: SleepBlockStrategy{t: time.Millisecond}}
+	l, err := New[int](h, WithCapacity(2), WithWaitStrategy(blocks))
+	assert.NoError(t, err)
+	blocks.target = &l.writer.seqer.rc
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	// buffer写满后，等待期间按照用户传入的策略等待
+	p := l.Producer()
+	assert.NoError(t, p.Write(0))
+	<-h.entered
+	assert.NoError(t, p.Write(1))
+	assert.NoError(t, p.Write(2))
+	assert.ErrorIs(t, p.TryWriteTimeout(3, 20*time.Millisecond), ErrTimeout)
+	assert.True(t, atomic.LoadInt64(&blocks.count) > 0)
+	close(h.gate)
+	assert.NoError(t, p.TryWriteTimeout(3, time.Second))
+	assert.Eventually(t, func() bool {
+		return h.count() == 4
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestProducerBlockReleaseOnClose(t *testing.T) {
+	eh := &sleepEventHandler[uint64]{
+		sm: time.Hour,
+	}
+	disruptor := NewLockfree[uint64](2, eh, NewConditionBlockStrategy())
+	assert.NoError(t, disruptor.Start())
+	producer := disruptor.Producer()
+	// 第一个被消费端取走后阻塞在处理中，后续两个写满buffer，最后一个阻塞
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, producer.Write(uint64(i)))
+	}
+	errC := make(chan error)
+	go func() {
+		errC <- producer.Write(3)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, disruptor.Close())
+	select {
+	case err := <-errC:
+		assert.ErrorIs(t, err, ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("producer is still blocked after close")
+	}
+}
+
+type reusableEvent struct {
+	buf []byte
+}
+
+// reuseEventHandler 记录事件内容及事件对象地址的处理器，同时实现了 EventClearer
+type reuseEventHandler struct {
+	mu       sync.Mutex
+	contents []string
+	objs     map[*reusableEvent]struct{}
+	clears   int
+}
+
+func (h *reuseEventHandler) OnEvent(v *reusableEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.contents = append(h.contents, string(v.buf))
+	h.objs[v] = struct{}{}
+}
+
+func (h *reuseEventHandler) Clear(v **reusableEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	(*v).buf = (*v).buf[:0]
+	h.clears++
+}
+
+func TestLockfreeWithFactory(t *testing.T) {
+	eh := &reuseEventHandler{
+		objs: make(map[*reusableEvent]struct{}),
+	}
+	factory := func() *reusableEvent {
+		return &reusableEvent{buf: make([]byte, 0, 16)}
+	}
+	disruptor := NewLockfreeWithFactory[*reusableEvent](4, eh, NewConditionBlockStrategy(), factory)
+	assert.NoError(t, disruptor.Start())
+	producer := disruptor.Producer()
+	total := 100
+	for i := 0; i < total; i++ {
+		err := PublishOneArg(producer, func(slot **reusableEvent, seq uint64, i int) {
+			(*slot).buf = append((*slot).buf, fmt.Sprintf("msg-%d", i)...)
+		}, i)
+		assert.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		eh.mu.Lock()
+		defer eh.mu.Unlock()
+		return eh.clears == total
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, disruptor.Close())
+	for i, c := range eh.contents {
+		assert.Equal(t, fmt.Sprintf("msg-%d", i), c)
+	}
+	// 所有事件均复用预先创建的对象
+	assert.Equal(t, 4, len(eh.objs))
+}
+
+// sequencedEventHandler 记录事件对应的序号
+type sequencedEventHandler struct {
+	mu   sync.Mutex
+	seqs map[int]uint64
+}
+
+func (h *sequencedEventHandler) OnEvent(v int) {
+	panic("OnEvent should not be called")
+}
+
+func (h *sequencedEventHandler) OnSequenceEvent(v int, seq uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seqs[v] = seq
+}
+
+func (h *sequencedEventHandler) len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.seqs)
+}
+
+func TestSequencedEventHandler(t *testing.T) {
+	h := &sequencedEventHandler{seqs: make(map[int]uint64)}
+	l, err := New[int](h)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	p := l.Producer()
+	assert.NoError(t, p.Write(1))
+	wc, ok, err := p.WriteTimeout(2, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, p.WriteAfter(3, 0))
+	assert.Eventually(t, func() bool {
+		return h.len() == 3
+	}, 5*time.Second, time.Millisecond)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	assert.Equal(t, uint64(1), h.seqs[1])
+	assert.Equal(t, wc, h.seqs[2])
+	// 定时事件没有序号
+	assert.Equal(t, uint64(0), h.seqs[3])
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import "math/bits"
+
+const (
+	defaultName     = "Disruptor"
+	defaultCapacity = 1024
+	maxCapacity     = 1 << (bits.UintSize - 2) // int范围内最大的2^n
+)
+
+// ProducerType 生产者类型
+type ProducerType int
+
+const (
+	// ProducerMulti 多生产者，写入序号通过原子自增获取，支持多个g并发写入，为默认类型
+	ProducerMulti ProducerType = iota
+	// ProducerSingle 单生产者，同一时刻仅允许一个g写入，写入序号的获取不需要原子的读改写操作
+	ProducerSingle
+)
+
+// options 创建Lockfree时的配置
+// 与事件类型相关的配置（如异常处理器、事件工厂）由于Option不带泛型，使用any保存，在创建时进行类型检查
+type options struct {
+	name         string
+	capacity     int
+	strict       bool // 容量不是2^n时是否返回错误
+	blocks       blockStrategy
+	producerType ProducerType
+	exception    any   // ExceptionHandler[T]
+	factory      any   // EventFactory[T]
+	spill        any   // *spillConfig[T]
+	weights      []int // 各优先级通道的权重，仅用于 NewPriority
+	retry        *RetryPolicy
+	deadLetter   any // deadLetterFunc[T]
+	rateLimit    *rateLimit
+	stall        *StallPolicy
+	watermarks   *Watermarks
+}
+
+func defaultOptions() *options {
+	return &options{
+		name:         defaultName,
+		capacity:     defaultCapacity,
+		blocks:       NewChanBlockStrategy(),
+		producerType: ProducerMulti,
+	}
+}
+
+// Option 创建Lockfree时的配置项
+type Option func(o *options)
+
+// WithName 设置名称，用于错误信息等场景，默认为Disruptor
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithCapacity 设置buffer的容量大小，不是2^n时会被调整为不小于它的最小的2^n，默认为1024
+func WithCapacity(capacity int) Option {
+	return func(o *options) {
+		o.capacity = capacity
+	}
+}
+
+// WithStrictCapacity 设置严格容量模式，容量不是2^n时返回错误，而不是自动调整
+func WithStrictCapacity() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WithWaitStrategy 设置阻塞策略，默认为 ChanBlockStrategy
+func WithWaitStrategy(blocks blockStrategy) Option {
+	return func(o *options) {
+		o.blocks = blocks
+	}
+}
+
+// WithProducerType 设置生产者类型，默认为 ProducerMulti
+func WithProducerType(producerType ProducerType) Option {
+	return func(o *options) {
+		o.producerType = producerType
+	}
+}
+
+// WithExceptionHandler 设置异常处理器，设置后事件处理器的panic会被捕获并交由该处理器处理，消费端继续处理后续事件
+// 其类型参数需要与Lockfree的事件类型一致
+func WithExceptionHandler[T any](handler ExceptionHandler[T]) Option {
+	return func(o *options) {
+		o.exception = handler
+	}
+}
+
+// WithEventFactory 设置事件工厂，参考 NewLockfreeWithFactory
+// 其类型参数需要与Lockfree的事件类型一致
+func WithEventFactory[T any](factory EventFactory[T]) Option {
+	return func(o *options) {
+		o.factory = factory
+	}
+}
+
+// WithLaneWeights 设置 PriorityLockfree 各通道的权重，数量需要与通道数量一致，且均大于0，仅用于 NewPriority
+// 设置后消费端按照权重轮流处理各通道的事件（加权公平），即每一轮中通道i最多连续处理weights[i]个事件；
+// 未设置时为严格优先级，即总是先处理优先级最高的通道中的事件
+func WithLaneWeights(weights ...int) Option {
+	return func(o *options) {
+		o.weights = weights
+	}
+}
+
+// checkOptions 校验配置是否合法
+func checkOptions[T any](handler EventHandler[T], o *options) error {
+	if err := checkHandler[T](handler, o); err != nil {
+		return err
+	}
+	return checkBaseOptions[T](o)
+}
+
+// checkHandler 校验事件处理器与配置是否匹配
+func checkHandler[T any](handler EventHandler[T], o *options) error {
+	if handler == nil {
+		return configError("event handler is nil")
+	}
+	if _, ok := handler.(retainHandler); ok && (o.factory != nil || o.retry != nil) {
+		return configError("event factory and retry are not supported by handler %T", handler)
+	}
+	return nil
+}
+
+// checkBaseOptions 校验与事件处理器无关的配置
+func checkBaseOptions[T any](o *options) error {
+	if _, err := NextPowerOfTwo(o.capacity); err != nil {
+		return err
+	}
+	if o.strict && !isPowerOfTwo(o.capacity) {
+		return configError("capacity %d is not a power of two", o.capacity)
+	}
+	if o.blocks == nil {
+		return configError("block strategy is nil")
+	}
+	if o.producerType != ProducerMulti && o.producerType != ProducerSingle {
+		return configError("unknown producer type %d", o.producerType)
+	}
+	if o.exception != nil {
+		if h, ok := o.exception.(ExceptionHandler[T]); !ok || h == nil {
+			return configError("exception handler type %T mismatch", o.exception)
+		}
+	}
+	if o.factory != nil {
+		if f, ok := o.factory.(EventFactory[T]); !ok || f == nil {
+			return configError("event factory type %T mismatch", o.factory)
+		}
+	}
+	if o.retry != nil && (o.retry.MaxAttempts < 1 || o.retry.Backoff < 0 || o.retry.MaxBackoff < 0) {
+		return configError("retry requires positive max attempts and non-negative backoff")
+	}
+	if o.rateLimit != nil && !(o.rateLimit.rate > 0 && o.rateLimit.burst >= 1) {
+		return configError("rate limit requires positive rate and burst")
+	}
+	if o.stall != nil && o.stall.Threshold <= 0 {
+		return configError("stall watchdog requires positive threshold")
+	}
+	if w := o.watermarks; w != nil && !(w.High > 0 && w.High <= 1 && w.Low >= 0 && w.Low < w.High) {
+		return configError("watermarks require 0 <= low < high <= 1")
+	}
+	if o.deadLetter != nil {
+		if f, ok := o.deadLetter.(deadLetterFunc[T]); !ok || f == nil {
+			return configError("dead letter type %T mismatch", o.deadLetter)
+		}
+	}
+	if o.spill != nil {
+		cfg, ok := o.spill.(*spillConfig[T])
+		if !ok {
+			return configError("spill type %T mismatch", o.spill)
+		}
+		if cfg.dir == "" || cfg.codec == nil || cfg.maxBytes <= 0 {
+			return configError("spill requires dir, codec and positive max bytes")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type panicEventHandler[T any] struct {
+	count int64
+}
+
+func (h *panicEventHandler[T]) OnEvent(v T) {
+	h.count++
+	if h.count%2 == 0 {
+		panic(errors.New("even event"))
+	}
+}
+
+type recordExceptionHandler[T any] struct {
+	mu   sync.Mutex
+	seqs []uint64
+	errs []error
+}
+
+func (h *recordExceptionHandler[T]) OnException(v T, seq uint64, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seqs = append(h.seqs, seq)
+	h.errs = append(h.errs, err)
+}
+
+func (h *recordExceptionHandler[T]) len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.seqs)
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	eh := &countEventHandler[uint64]{}
+	cases := []struct {
+		name    string
+		handler EventHandler[uint64]
+		opts    []Option
+	}{
+		{"nil handler", nil, nil},
+		{"zero capacity", eh, []Option{WithCapacity(0)}},
+		{"negative capacity", eh, []Option{WithCapacity(-1)}},
+		{"capacity overflow", eh, []Option{WithCapacity(maxCapacity + 1)}},
+		{"strict capacity", eh, []Option{WithCapacity(1000), WithStrictCapacity()}},
+		{"nil strategy", eh, []Option{WithWaitStrategy(nil)}},
+		{"unknown producer type", eh, []Option{WithProducerType(ProducerType(10))}},
+		{"exception type mismatch", eh, []Option{WithExceptionHandler[string](&recordExceptionHandler[string]{})}},
+		{"factory type mismatch", eh, []Option{WithEventFactory(func() int { return 0 })}},
+	}
+	for _, c := range cases {
+		lf, err := New[uint64](c.handler, c.opts...)
+		assert.Nil(t, lf, c.name)
+		assert.True(t, errors.Is(err, ErrInvalidConfig), c.name)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	eh := &countEventHandler[uint64]{}
+	lf, err := New[uint64](eh,
+		WithName("orders"),
+		WithCapacity(100),
+		WithWaitStrategy(NewConditionBlockStrategy()),
+		WithProducerType(ProducerSingle),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(128), lf.Producer().capacity)
+	assert.NoError(t, lf.Start())
+	assert.EqualError(t, lf.Start(), "start model [orders] error: already started")
+	producer := lf.Producer()
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, producer.Write(uint64(i)))
+	}
+	assert.Eventually(t, func() bool {
+		return eh.load() == 1000
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, lf.Close())
+	assert.EqualError(t, lf.Close(), "close model [orders] error: not running")
+}
+
+func TestNewWithExceptionHandler(t *testing.T) {
+	eh := &panicEventHandler[uint64]{}
+	exh := &recordExceptionHandler[uint64]{}
+	lf, err := New[uint64](eh, WithExceptionHandler[uint64](exh))
+	assert.NoError(t, err)
+	assert.NoError(t, lf.Start())
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, lf.Producer().Write(uint64(i)))
+	}
+	assert.Eventually(t, func() bool {
+		return exh.len() == 5
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, lf.Close())
+	assert.Equal(t, []uint64{2, 4, 6, 8, 10}, exh.seqs)
+	assert.EqualError(t, exh.errs[0], "even event")
+}
+
+func TestEstimateMemory(t *testing.T) {
+	small, err := EstimateMemory[uint64](1000)
+	assert.NoError(t, err)
+	large, err := EstimateMemory[uint64](1024 * 1024)
+	assert.NoError(t, err)
+	// 每个位置包含游标及对象共16字节
+	assert.Equal(t, uint64(1024*1024-1024)*16, large-small)
+
+	_, err = EstimateMemory[[1024]byte](maxCapacity)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	_, err = EstimateMemory[uint64](0)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
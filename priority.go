@@ -0,0 +1,272 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// LaneStats 优先级通道的统计，由于执行时不加锁，该结果是不可靠的
+type LaneStats struct {
+	Priority int
+	Written  uint64 // 已获取写入序号的事件数量，包含正在写入的事件
+	Consumed uint64 // 已处理的事件数量
+	Pending  uint64 // 尚未处理的事件数量
+}
+
+// PriorityLockfree 优先级队列，由多个不同优先级的通道（buffer）组成，由同一个消费端的g按照优先级选择处理，
+// 用于控制类事件（如配置重载、关闭标记）不被大量数据类事件阻塞的场景。
+// 默认为严格优先级，即总是先处理优先级最高的通道，设置 WithLaneWeights 后按照权重在各通道间轮流处理；
+// 同一通道内的事件按照写入顺序处理，不同通道之间不保证顺序
+type PriorityLockfree[T any] struct {
+	name    string
+	lanes   []*priorityLane[T] // 下标即优先级，0为最高
+	weights []int              // 为nil时表示严格优先级
+	blocks  blockStrategy      // 消费端阻塞策略，所有通道共享
+	cur     int                // 加权公平时当前处理的通道，只由消费端的g访问
+	credit  int                // 当前通道剩余可处理的事件数量，只由消费端的g访问
+	status  int32
+}
+
+// priorityLane 优先级通道，复用消费者的读取逻辑，但不单独启动消费者的g
+type priorityLane[T any] struct {
+	seqer  *sequencer
+	writer *Producer[T]
+	cmer   *consumer[T]
+}
+
+// NewPriority 创建拥有lanes个优先级通道的PriorityLockfree，lanes小于1时为1，配置项应用于每个通道，参考 New
+// 不支持 WithSpill，事件处理器不能为 JournalHandler，不支持定时写入；
+// 事件处理器获取到的序号为事件在所在通道中的序号
+func NewPriority[T any](handler EventHandler[T], lanes int, opts ...Option) (*PriorityLockfree[T], error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := checkOptions[T](handler, o); err != nil {
+		return nil, err
+	}
+	if o.spill != nil {
+		return nil, configError("spill is not supported by priority lockfree")
+	}
+	if _, ok := handler.(*JournalHandler[T]); ok {
+		return nil, configError("journal handler is not supported by priority lockfree")
+	}
+	if o.stall != nil || o.watermarks != nil {
+		return nil, configError("stall watchdog and watermarks are not supported by priority lockfree")
+	}
+	if lanes < 1 {
+		lanes = 1
+	}
+	if o.weights != nil {
+		if len(o.weights) != lanes {
+			return nil, configError("lane weights count %d mismatch lanes %d", len(o.weights), lanes)
+		}
+		for _, w := range o.weights {
+			if w <= 0 {
+				return nil, configError("lane weight %d is not positive", w)
+			}
+		}
+	}
+	o.capacity, _ = NextPowerOfTwo(o.capacity)
+	l := &PriorityLockfree[T]{
+		name:    o.name,
+		lanes:   make([]*priorityLane[T], lanes),
+		weights: o.weights,
+		status:  READY,
+	}
+	if l.weights != nil {
+		l.credit = l.weights[0]
+	}
+	factory, _ := o.factory.(EventFactory[T])
+	exception, _ := o.exception.(ExceptionHandler[T])
+	dead, _ := o.deadLetter.(deadLetterFunc[T])
+	// 所有通道共用一个消费端的g，限流同样由所有通道共享
+	limiter := newTokenBucket(o.rateLimit)
+	wake := &alarm{}
+	// 消费端需要同时等待所有的通道，阻塞时除第一个通道外还需要判断其他通道是否有事件
+	l.blocks = newReadyBlockStrategy(o.blocks, func() bool {
+		return l.closed() || l.pending() || wake.ready()
+	})
+	wake.release = l.blocks.release
+	writers := make([]*Producer[T], lanes)
+	for i := range l.lanes {
+		seqer := newSequencer(o.capacity)
+		rbuf := newRingBuffer[T](o.capacity)
+		if factory != nil {
+			rbuf.fill(factory)
+		}
+		pblocks := newSharedBlockStrategy(o.blocks)
+		writers[i] = newProducer[T](seqer, rbuf, l.blocks, pblocks, o.producerType == ProducerSingle)
+		writers[i].name = o.name
+		writers[i].lanes = writers
+		cmer := newConsumer[T](rbuf, handler, seqer, l.blocks, pblocks, factory != nil, exception)
+		cmer.retry = o.retry
+		cmer.dead = dead
+		cmer.wake = wake
+		cmer.limiter = limiter
+		l.lanes[i] = &priorityLane[T]{
+			seqer:  seqer,
+			writer: writers[i],
+			cmer:   cmer,
+		}
+	}
+	return l, nil
+}
+
+// Producer 获取生产者，Write 写入优先级最低的通道，通过 Producer.WriteWithPriority 写入指定优先级的通道
+func (l *PriorityLockfree[T]) Producer() *Producer[T] {
+	return l.lanes[len(l.lanes)-1].writer
+}
+
+// Lanes 通道数量
+func (l *PriorityLockfree[T]) Lanes() int {
+	return len(l.lanes)
+}
+
+// Stats 获取各通道的统计，下标即优先级
+func (l *PriorityLockfree[T]) Stats() []LaneStats {
+	stats := make([]LaneStats, len(l.lanes))
+	for i, lane := range l.lanes {
+		consumed := lane.seqer.nextRead() - 1
+		written := lane.seqer.wc.atomicLoad()
+		stats[i] = LaneStats{
+			Priority: i,
+			Written:  written,
+			Consumed: consumed,
+		}
+		if written > consumed {
+			stats[i].Pending = written - consumed
+		}
+	}
+	return stats
+}
+
+func (l *PriorityLockfree[T]) Start() error {
+	if atomic.CompareAndSwapInt32(&l.status, READY, RUNNING) {
+		for i, lane := range l.lanes {
+			if err := lane.writer.start(); err != nil {
+				// 恢复现场
+				for _, x := range l.lanes[:i] {
+					_ = x.writer.close()
+				}
+				atomic.CompareAndSwapInt32(&l.status, RUNNING, READY)
+				return err
+			}
+		}
+		for _, lane := range l.lanes {
+			// 通道的消费者不单独启动g，只标记运行状态，用于重试、限流等判断是否已关闭
+			atomic.StoreInt32(&lane.cmer.status, RUNNING)
+		}
+		go l.handle()
+		return nil
+	}
+	return startError(l.name)
+}
+
+func (l *PriorityLockfree[T]) Running() bool {
+	return atomic.LoadInt32(&l.status) == RUNNING
+}
+
+func (l *PriorityLockfree[T]) Close() error {
+	if atomic.CompareAndSwapInt32(&l.status, RUNNING, READY) {
+		var err error
+		for _, lane := range l.lanes {
+			if e := lane.writer.close(); e != nil && err == nil {
+				err = e
+			}
+		}
+		for _, lane := range l.lanes {
+			atomic.StoreInt32(&lane.cmer.status, READY)
+		}
+		// 防止阻塞无法释放
+		l.blocks.release()
+		return err
+	}
+	return closeError(l.name)
+}
+
+func (l *PriorityLockfree[T]) closed() bool {
+	return atomic.LoadInt32(&l.status) == READY
+}
+
+// pending 是否有通道已写入尚未处理的事件，只判断下一个要读取的位置是否已写入，
+// 已获取但未写入的位置（如 WriteTimeout 超时）不会使消费端一直无法阻塞，写入后会释放消费端
+func (l *PriorityLockfree[T]) pending() bool {
+	for _, lane := range l.lanes {
+		if _, _, ok := lane.cmer.rbuf.contains(lane.seqer.nextRead() - 1); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *PriorityLockfree[T]) handle() {
+	// 所有通道共用同一个事件处理器，批次结束的通知由任意一个通道的消费者发出即可
+	first := l.lanes[0].cmer
+	var batching = false
+	var i = 0
+	for {
+		if l.closed() {
+			first.exit(batching)
+			return
+		}
+		if l.poll() {
+			batching = true
+			i = 0
+			continue
+		}
+		if first.expire() {
+			// 事件处理器的截止时间已到
+			i = 0
+			continue
+		}
+		// 暂时读取不到新的事件，表示一个批次结束
+		first.endBatch(batching)
+		batching = false
+		if i < spin {
+			procyield(30)
+		} else if i < spin+passiveSpin {
+			runtime.Gosched()
+		} else {
+			rc := l.lanes[0].seqer.nextRead()
+			_, p, _ := first.rbuf.contains(rc - 1)
+			first.arm(rc)
+			l.blocks.block(p, rc)
+			i = 0
+		}
+		i++
+	}
+}
+
+// poll 按照选择策略处理一个事件，所有通道均没有事件时返回false
+func (l *PriorityLockfree[T]) poll() bool {
+	if l.weights == nil {
+		// 严格优先级，总是从优先级最高的通道开始查找
+		for _, lane := range l.lanes {
+			if _, ok := lane.cmer.consume(lane.seqer.nextRead()); ok {
+				return true
+			}
+		}
+		return false
+	}
+	// 加权公平，当前通道没有事件或额度用完时切换到下一个通道，最多查找一轮
+	for n := 0; n <= len(l.lanes); n++ {
+		if l.credit > 0 {
+			lane := l.lanes[l.cur]
+			if _, ok := lane.cmer.consume(lane.seqer.nextRead()); ok {
+				l.credit--
+				return true
+			}
+		}
+		l.cur = (l.cur + 1) % len(l.lanes)
+		l.credit = l.weights[l.cur]
+	}
+	return false
+}
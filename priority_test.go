@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeBacklog 先写入一个低优先级事件使消费端阻塞，再写入低优先级事件low个（值为1）及高优先级事件high个（值为0）
+func writeBacklog(t *testing.T, l *PriorityLockfree[int], h *gateEventHandler[int], low, high int) {
+	assert.NoError(t, l.Producer().Write(-1))
+	<-h.entered
+	for i := 0; i < low; i++ {
+		assert.NoError(t, l.Producer().Write(1))
+	}
+	for i := 0; i < high; i++ {
+		assert.NoError(t, l.Producer().WriteWithPriority(0, 0))
+	}
+	close(h.gate)
+	assert.Eventually(t, func() bool {
+		return h.count() == 1+low+high
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestPriorityStrict(t *testing.T) {
+	h := newGateEventHandler[int]()
+	l, err := NewPriority[int](h, 2, WithCapacity(64))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	writeBacklog(t, l, h, 20, 10)
+	values := h.snapshot()
+	assert.Equal(t, -1, values[0])
+	for i, v := range values[1:] {
+		if i < 10 {
+			assert.Equal(t, 0, v)
+		} else {
+			assert.Equal(t, 1, v)
+		}
+	}
+
+	stats := l.Stats()
+	assert.Equal(t, []LaneStats{
+		{Priority: 0, Written: 10, Consumed: 10},
+		{Priority: 1, Written: 21, Consumed: 21},
+	}, stats)
+}
+
+func TestPriorityWeighted(t *testing.T) {
+	h := newGateEventHandler[int]()
+	l, err := NewPriority[int](h, 2, WithCapacity(64), WithLaneWeights(3, 1))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	writeBacklog(t, l, h, 10, 12)
+	values := h.snapshot()
+	// 每一轮处理3个高优先级事件及1个低优先级事件，高优先级事件处理完后只剩低优先级事件
+	assert.Equal(t, []int{-1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1}, values)
+}
+
+func TestPriorityOptions(t *testing.T) {
+	h := newGateEventHandler[int]()
+	_, err := NewPriority[int](h, 2, WithLaneWeights(1))
+	assert.Error(t, err)
+	_, err = NewPriority[int](h, 2, WithLaneWeights(1, 0))
+	assert.Error(t, err)
+	_, err = New[int](h, WithLaneWeights(1))
+	assert.Error(t, err)
+
+	l, err := NewPriority[int](h, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l.Lanes())
+	assert.Error(t, l.Producer().WriteWithPriority(1, 1))
+	assert.ErrorIs(t, l.Producer().WriteWithPriority(1, 0), ClosedError)
+}
+
+func TestPriorityAbandonedCursorParks(t *testing.T) {
+	h := newGateEventHandler[int]()
+	l, err := NewPriority[int](h, 2, WithCapacity(2))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	// 低优先级通道写满后 WriteTimeout 超时，留下已获取但未写入的位置
+	p := l.Producer()
+	assert.NoError(t, p.Write(0))
+	<-h.entered
+	assert.NoError(t, p.Write(1))
+	assert.NoError(t, p.Write(2))
+	wc, ok, err := p.WriteTimeout(3, time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	close(h.gate)
+	assert.Eventually(t, func() bool {
+		return h.count() == 3
+	}, 5*time.Second, time.Millisecond)
+
+	// 该位置不会使消费端一直无法阻塞
+	blocks := l.blocks.(*sharedBlockStrategy)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&blocks.waiters) == 1
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&blocks.waiters))
+
+	ok, err = p.WriteByCursor(3, wc)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Eventually(t, func() bool {
+		return h.count() == 4
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []int{0, 1, 2, 3}, h.snapshot())
+}
@@ -8,8 +8,11 @@
 package lockfree
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -17,65 +20,184 @@ import (
 // Producer 生产者
 // 核心方法是Write，通过调用Write方法可以将对象写入到队列中
 type Producer[T any] struct {
+	name     string // 名称，用于错误信息
 	seqer    *sequencer
 	rbuf     *ringBuffer[T]
-	blocks   blockStrategy
+	blocks   blockStrategy        // 消费端阻塞策略，写入后释放
+	pblocks  *sharedBlockStrategy // 生产端阻塞策略，buffer写满时阻塞，由消费端释放
 	capacity uint64
 	status   int32
+	single   bool           // 是否为单生产者
+	spill    *spillQueue[T] // 溢出队列，未设置溢出模式时为nil
+	sched    *scheduler[T]  // 定时事件调度器，不支持定时写入时为nil
+	lanes    []*Producer[T] // 各优先级通道的生产者，仅 PriorityLockfree 的生产者设置
+	gate     func()         // 刷新读取游标，读取游标不由消费端直接维护时设置（如广播），在buffer写满时调用
+	mu       sync.Mutex
+	pending  map[uint64]struct{} // WriteTimeout 超时后尚未通过 WriteByCursor 写入的位置
 }
 
-func newProducer[T any](seqer *sequencer, rbuf *ringBuffer[T], blocks blockStrategy) *Producer[T] {
+func newProducer[T any](seqer *sequencer, rbuf *ringBuffer[T], blocks blockStrategy, pblocks *sharedBlockStrategy, single bool) *Producer[T] {
 	return &Producer[T]{
+		name:     "Producer",
 		seqer:    seqer,
 		rbuf:     rbuf,
 		blocks:   blocks,
+		pblocks:  pblocks,
 		capacity: rbuf.cap(),
 		status:   READY,
+		single:   single,
 	}
 }
 
 func (q *Producer[T]) start() error {
 	if atomic.CompareAndSwapInt32(&q.status, READY, RUNNING) {
+		q.pblocks.open()
 		return nil
 	}
-	return fmt.Errorf(StartErrorFormat, "Producer")
+	return startError(q.name)
 }
 
 // Write 对象写入核心逻辑
 // 首先会从序号产生器中获取一个序号，该序号由atomic自增，不会重复；
 // 然后通过&运算获取该序号应该放入的位置pos；
 // 通过循环的方式，判断对应pos位置是否可以写入内容，这个判断是通过available数组判断的；
-// 如果无法写入则持续循环等待，直到可以写入为止，此处基于一种思想即写入的实时性，写入操作不需要等太久，因此此处是没有阻塞的，
-// 仅仅通过调度让出的方式，进行一部分cpu让渡，防止持续占用cpu资源
+// 如果无法写入则循环等待，直到可以写入为止，此处基于一种思想即写入的实时性，写入操作不需要等太久，
+// 因此会先通过调度让出的方式进行少量的cpu让渡，之后再按照阻塞策略等待，由消费端读取后释放，防止大量生产者持续占用cpu资源
 // 获取到写入资格后将内容写入到ringbuffer，同时更新available数组，并且调用release，以便于释放消费端的阻塞等待
+// 设置了溢出模式时，若buffer已满则会将对象写入溢出文件，参考 WithSpill
 func (q *Producer[T]) Write(v T) error {
+	_, err := q.write(v)
+	return err
+}
+
+// write 写入对象，返回写入的序号
+func (q *Producer[T]) write(v T) (uint64, error) {
+	if q.spill != nil && q.WriteWindow() <= 0 {
+		if q.closed() {
+			return 0, writeError(q.name, 0, ErrClosed)
+		}
+		next, spilled, err := q.spill.offer(v, q.increment)
+		if err != nil {
+			return 0, writeError(q.name, next, err)
+		}
+		if spilled {
+			q.blocks.release()
+			return next, nil
+		}
+		if next > 0 {
+			// 已获取序号但写入文件失败，退化为等待buffer写入
+			if err = q.wait(next); err != nil {
+				return 0, err
+			}
+			q.rbuf.write(next-1, v)
+			q.blocks.release()
+			return next, nil
+		}
+		// 溢出文件已满，退化为等待buffer写入
+	}
+	next, err := q.claim()
+	if err != nil {
+		return 0, err
+	}
+	// 可以写入数据，将数据写入到指定位置
+	q.rbuf.write(next-1, v)
+	// 释放，防止消费端阻塞
+	q.blocks.release()
+	return next, nil
+}
+
+// claim 获取写入序号，并等待该序号对应的位置可以写入
+func (q *Producer[T]) claim() (uint64, error) {
 	if q.closed() {
-		return ClosedError
+		return 0, writeError(q.name, 0, ErrClosed)
 	}
-	next := q.seqer.wc.increment()
+	next := q.increment()
+	return next, q.wait(next)
+}
+
+// wait 等待序号对应的位置可以写入
+func (q *Producer[T]) wait(next uint64) error {
+	var i = 0
 	for {
 		// 判断是否可以写入
-		r := atomic.LoadUint64(&q.seqer.rc) - 1
-		if next <= r+q.capacity {
-			// 可以写入数据，将数据写入到指定位置
-			q.rbuf.write(next-1, v)
-			// 释放，防止消费端阻塞
-			q.blocks.release()
+		if q.available(next) {
 			return nil
 		}
-		runtime.Gosched()
+		if i < passiveSpin {
+			runtime.Gosched()
+		} else {
+			// 等待读取游标推进到可写入的位置，即 rc >= next + 1 - capacity
+			q.pblocks.block(&q.seqer.rc, next+1-q.capacity)
+		}
+		i++
 		// 再次判断是否已关闭
 		if q.closed() {
-			return ClosedError
+			return writeError(q.name, next, ErrClosed)
 		}
 	}
 }
 
+// available 判断序号对应的位置是否可以写入，设置了gate时会在不可写入时刷新读取游标后再判断
+func (q *Producer[T]) available(next uint64) bool {
+	if next <= atomic.LoadUint64(&q.seqer.rc)-1+q.capacity {
+		return true
+	}
+	if q.gate == nil {
+		return false
+	}
+	q.gate()
+	return next <= atomic.LoadUint64(&q.seqer.rc)-1+q.capacity
+}
+
+// WriteAt 定时写入，事件会在at之后交给消费端的事件处理器处理，at早于当前时间时会尽快处理
+// 定时事件不占用buffer及序号，也不受buffer容量的限制，多个定时事件按照时间顺序处理，精度为毫秒；
+// 事件处理器获取到的序号为0，事件处理器为 JournalHandler 时不支持定时写入
+func (q *Producer[T]) WriteAt(v T, at time.Time) error {
+	if q.closed() {
+		return writeError(q.name, 0, ErrClosed)
+	}
+	if q.sched == nil {
+		return writeError(q.name, 0, fmt.Errorf("scheduled write %w", ErrUnsupported))
+	}
+	q.sched.add(v, at)
+	return nil
+}
+
+// WriteAfter 延时写入，事件会在d之后交给消费端的事件处理器处理，参考 WriteAt
+func (q *Producer[T]) WriteAfter(v T, d time.Duration) error {
+	return q.WriteAt(v, time.Now().Add(d))
+}
+
+// WriteWithPriority 按照优先级写入，p为通道的优先级，0为最高，参考 PriorityLockfree
+// 非 PriorityLockfree 的生产者只有一个通道，p只能为0
+func (q *Producer[T]) WriteWithPriority(v T, p int) error {
+	if q.lanes == nil {
+		if p != 0 {
+			return writeError(q.name, 0, fmt.Errorf("%w: %d out of range [0, 1)", ErrInvalidPriority, p))
+		}
+		return q.Write(v)
+	}
+	if p < 0 || p >= len(q.lanes) {
+		return writeError(q.name, 0, fmt.Errorf("%w: %d out of range [0, %d)", ErrInvalidPriority, p, len(q.lanes)))
+	}
+	return q.lanes[p].Write(v)
+}
+
+// increment 获取下一个写入序号，单生产者时不需要原子自增
+func (q *Producer[T]) increment() uint64 {
+	if q.single {
+		return q.seqer.wc.incrementSingle()
+	}
+	return q.seqer.wc.increment()
+}
+
 // WriteWindow 写入窗口
 // 描述当前可写入的状态，如果不能写入则返回零值，如果可以写入则返回写入窗口大小
 // 由于执行时不加锁，所以该结果是不可靠的，仅用于在并发环境很高的情况下，进行丢弃行为
 func (q *Producer[T]) WriteWindow() int {
 	next := q.seqer.wc.atomicLoad() + 1
+	// 设置了gate时刷新读取游标
+	q.available(next)
 	r := atomic.LoadUint64(&q.seqer.rc)
 	if next < r+q.capacity {
 		return int(r + q.capacity - next)
@@ -89,9 +211,9 @@ func (q *Producer[T]) WriteWindow() int {
 // 三个返回项：写入位置、是否写入成功及是否有error
 func (q *Producer[T]) WriteTimeout(v T, timeout time.Duration) (uint64, bool, error) {
 	if q.closed() {
-		return 0, false, ClosedError
+		return 0, false, writeError(q.name, 0, ErrClosed)
 	}
-	next := q.seqer.wc.increment()
+	next := q.increment()
 
 	// 先尝试写数据 (failfast)
 	ok := q.writeByCursor(v, next)
@@ -106,7 +228,13 @@ func (q *Producer[T]) WriteTimeout(v T, timeout time.Duration) (uint64, bool, er
 	for {
 		select {
 		case <-waiter.C:
-			// 超时触发，执行到此处表示未写入，返回对应结果即可
+			// 超时触发，执行到此处表示未写入，记录该位置后返回对应结果即可
+			q.mu.Lock()
+			if q.pending == nil {
+				q.pending = make(map[uint64]struct{})
+			}
+			q.pending[next] = struct{}{}
+			q.mu.Unlock()
 			return next, false, nil
 		default:
 			ok = q.writeByCursor(v, next)
@@ -117,26 +245,100 @@ func (q *Producer[T]) WriteTimeout(v T, timeout time.Duration) (uint64, bool, er
 		}
 
 		if q.closed() {
-			return 0, false, ClosedError
+			return 0, false, writeError(q.name, next, ErrClosed)
 		}
 	}
 }
 
 // WriteByCursor 根据游标写入内容，wc是调用 WriteTimeout 方法返回false时对应的写入位置，
-// 该位置有严格的含义，不要随意填值，否则会造成整个队列异常
+// 生产者会记录这些位置，wc不是尚未写入的这类位置（如未获取、已写入的位置）时返回 ErrInvalidCursor
 // 函数返回值：是否写入成功和是否存在error，若返回false表示写入失败，可以继续调用重复写入
 func (q *Producer[T]) WriteByCursor(v T, wc uint64) (bool, error) {
 	if q.closed() {
-		return false, ClosedError
+		return false, writeError(q.name, wc, ErrClosed)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[wc]; !ok {
+		return false, writeError(q.name, wc, ErrInvalidCursor)
 	}
+	if !q.writeByCursor(v, wc) {
+		return false, nil
+	}
+	delete(q.pending, wc)
+	return true, nil
+}
+
+// PendingCursors 获取 WriteTimeout 超时后尚未通过 WriteByCursor 写入的位置，按照从小到大排序，
+// 消费端会一直等待这些位置被写入，用于排查因未继续写入而导致消费端停滞的问题
+func (q *Producer[T]) PendingCursors() []uint64 {
+	q.mu.Lock()
+	cursors := make([]uint64, 0, len(q.pending))
+	for wc := range q.pending {
+		cursors = append(cursors, wc)
+	}
+	q.mu.Unlock()
+	sort.Slice(cursors, func(i, j int) bool {
+		return cursors[i] < cursors[j]
+	})
+	return cursors
+}
+
+// skip 放弃 WriteTimeout 超时后尚未写入的位置，由消费端在停滞时调用，wc不是此类位置时返回false
+func (q *Producer[T]) skip(wc uint64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[wc]; !ok {
+		return false
+	}
+	delete(q.pending, wc)
+	return true
+}
 
-	return q.writeByCursor(v, wc), nil
+// TryWrite 写入对象，buffer已满时不会等待，直接返回 ErrFull，此时不会占用写入位置
+func (q *Producer[T]) TryWrite(v T) error {
+	if q.closed() {
+		return writeError(q.name, 0, ErrClosed)
+	}
+	for {
+		wc := q.seqer.wc.atomicLoad()
+		next := wc + 1
+		if !q.available(next) {
+			return writeError(q.name, 0, ErrFull)
+		}
+		if q.seqer.wc.store(wc, next) {
+			q.rbuf.write(next-1, v)
+			q.blocks.release()
+			return nil
+		}
+	}
+}
+
+// TryWriteTimeout 写入对象，buffer已满时最多等待timeout，超时后返回 ErrTimeout，
+// 与 WriteTimeout 不同，超时时不会占用写入位置，调用方无需继续写入
+func (q *Producer[T]) TryWriteTimeout(v T, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for i := 0; ; i++ {
+		err := q.TryWrite(v)
+		if !errors.Is(err, ErrFull) {
+			return err
+		}
+		if !time.Now().Before(deadline) {
+			return writeError(q.name, 0, ErrTimeout)
+		}
+		if i < passiveSpin {
+			runtime.Gosched()
+		} else {
+			// 与wait一致，等待读取游标推进到下一个序号可写入的位置，最多等待到deadline
+			next := q.seqer.wc.atomicLoad() + 1
+			q.pblocks.blockUntil(&q.seqer.rc, next+1-q.capacity, deadline)
+		}
+	}
 }
 
 func (q *Producer[T]) writeByCursor(v T, wc uint64) bool {
 	// 判断是否可以写入
-	r := atomic.LoadUint64(&q.seqer.rc) - 1
-	if wc <= r+q.capacity {
+	if q.available(wc) {
 		// 可以写入数据，将数据写入到指定位置
 		q.rbuf.write(wc-1, v)
 		// 释放，防止消费端阻塞
@@ -149,9 +351,11 @@ func (q *Producer[T]) writeByCursor(v T, wc uint64) bool {
 
 func (q *Producer[T]) close() error {
 	if atomic.CompareAndSwapInt32(&q.status, RUNNING, READY) {
+		// 释放所有阻塞的生产者
+		q.pblocks.close()
 		return nil
 	}
-	return fmt.Errorf(CloseErrorFormat, "Producer")
+	return closeError(q.name)
 }
 
 func (q *Producer[T]) closed() bool {
@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Queue 有界的多生产者多消费者队列，不需要事件处理器，由调用方主动读取
+// 基于ringBuffer实现，每个位置的游标c描述该位置的状态：
+// c == pos 表示位置pos可以写入，c == pos+1 表示位置pos可以读取，读取后将c设置为pos+capacity，即下一轮的写入位置；
+// 写入和读取分别通过cursor维护下一个位置，通过CAS抢占，Offer和Poll均不会阻塞，Put和Take在无法写入或读取时等待
+type Queue[T any] struct {
+	rbuf     *ringBuffer[T]
+	head     *cursor // 下一个写入位置
+	tail     *cursor // 下一个读取位置
+	capacity uint64
+	putters  int32         // 等待写入的g数量
+	takers   int32         // 等待读取的g数量
+	notFull  chan struct{} // 读取后通知等待写入的g
+	notEmpty chan struct{} // 写入后通知等待读取的g
+}
+
+// NewQueue 创建队列，capacity要求是2^n，如果不是的话会被修改
+func NewQueue[T any](capacity int) *Queue[T] {
+	capacity = minSuitableCap(capacity)
+	rbuf := newRingBuffer[T](capacity)
+	rbuf.initSequence()
+	return &Queue[T]{
+		rbuf:     rbuf,
+		head:     newCursor(),
+		tail:     newCursor(),
+		capacity: uint64(capacity),
+		notFull:  make(chan struct{}, 1),
+		notEmpty: make(chan struct{}, 1),
+	}
+}
+
+// Offer 写入对象，队列已满时返回false
+func (q *Queue[T]) Offer(v T) bool {
+	if !q.offer(v) {
+		return false
+	}
+	q.signal(&q.takers, q.notEmpty)
+	return true
+}
+
+func (q *Queue[T]) offer(v T) bool {
+	pos := q.head.atomicLoad()
+	for {
+		seq := q.rbuf.sequence(pos)
+		if seq == pos {
+			// 位置可以写入，抢占成功后写入
+			if q.head.store(pos, pos+1) {
+				q.rbuf.put(pos, v, pos+1)
+				return true
+			}
+			pos = q.head.atomicLoad()
+		} else if seq < pos {
+			// 该位置上一轮的对象尚未被读取，队列已满
+			return false
+		} else {
+			// 已被其他g写入，重新获取位置
+			pos = q.head.atomicLoad()
+		}
+	}
+}
+
+// Poll 读取对象，队列为空时返回false
+func (q *Queue[T]) Poll() (T, bool) {
+	v, ok := q.poll()
+	if ok {
+		q.signal(&q.putters, q.notFull)
+	}
+	return v, ok
+}
+
+func (q *Queue[T]) poll() (T, bool) {
+	pos := q.tail.atomicLoad()
+	for {
+		seq := q.rbuf.sequence(pos)
+		if seq == pos+1 {
+			// 位置可以读取，抢占成功后读取，并将位置设置为下一轮可写入
+			if q.tail.store(pos, pos+1) {
+				return q.rbuf.take(pos, pos+q.capacity), true
+			}
+			pos = q.tail.atomicLoad()
+		} else if seq < pos+1 {
+			// 该位置尚未写入，队列为空
+			return q.rbuf.tDefault, false
+		} else {
+			// 已被其他g读取，重新获取位置
+			pos = q.tail.atomicLoad()
+		}
+	}
+}
+
+// Put 写入对象，队列已满时等待，直到写入成功或者ctx结束，ctx结束时返回ctx.Err()
+func (q *Queue[T]) Put(ctx context.Context, v T) error {
+	if q.Offer(v) {
+		return nil
+	}
+	// 先增加等待者数量再尝试写入，与Poll中先读取再判断等待者数量相对应，防止丢失通知
+	atomic.AddInt32(&q.putters, 1)
+	defer atomic.AddInt32(&q.putters, -1)
+	for {
+		if q.offer(v) {
+			q.signal(&q.takers, q.notEmpty)
+			// 可能有多个g在等待，仍有空余位置时传递通知
+			if q.Size() < q.capacity {
+				q.signal(&q.putters, q.notFull)
+			}
+			return nil
+		}
+		select {
+		case <-q.notFull:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Take 读取对象，队列为空时等待，直到读取成功或者ctx结束，ctx结束时返回ctx.Err()
+func (q *Queue[T]) Take(ctx context.Context) (T, error) {
+	if v, ok := q.Poll(); ok {
+		return v, nil
+	}
+	atomic.AddInt32(&q.takers, 1)
+	defer atomic.AddInt32(&q.takers, -1)
+	for {
+		if v, ok := q.poll(); ok {
+			q.signal(&q.putters, q.notFull)
+			// 可能有多个g在等待，仍有对象时传递通知
+			if q.Size() > 0 {
+				q.signal(&q.takers, q.notEmpty)
+			}
+			return v, nil
+		}
+		select {
+		case <-q.notEmpty:
+		case <-ctx.Done():
+			return q.rbuf.tDefault, ctx.Err()
+		}
+	}
+}
+
+// signal 存在等待者时发送通知，通知已存在时不重复发送
+func (q *Queue[T]) signal(waiters *int32, ch chan struct{}) {
+	if atomic.LoadInt32(waiters) == 0 {
+		return
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Size 队列中对象的数量，由于执行时不加锁，该结果是不可靠的
+func (q *Queue[T]) Size() uint64 {
+	tail := q.tail.atomicLoad()
+	head := q.head.atomicLoad()
+	if head <= tail {
+		return 0
+	}
+	if head-tail > q.capacity {
+		return q.capacity
+	}
+	return head - tail
+}
+
+// Cap 容量
+func (q *Queue[T]) Cap() uint64 {
+	return q.capacity
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueOfferPoll(t *testing.T) {
+	q := NewQueue[int](3)
+	assert.Equal(t, uint64(4), q.Cap())
+	_, ok := q.Poll()
+	assert.False(t, ok)
+	for i := 0; i < 4; i++ {
+		assert.True(t, q.Offer(i))
+	}
+	assert.False(t, q.Offer(4))
+	assert.Equal(t, uint64(4), q.Size())
+	// 多轮读写，保证位置可以复用
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 4; i++ {
+			v, ok := q.Poll()
+			assert.True(t, ok)
+			assert.Equal(t, round*4+i, v)
+		}
+		_, ok = q.Poll()
+		assert.False(t, ok)
+		for i := 0; i < 4; i++ {
+			assert.True(t, q.Offer((round+1)*4+i))
+		}
+	}
+}
+
+func TestQueueConcurrent(t *testing.T) {
+	var (
+		q       = NewQueue[int](8)
+		goS     = 4
+		perGo   = 2000
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		counts  = make(map[int]int)
+		ctx     = context.Background()
+		readers sync.WaitGroup
+	)
+	for g := 0; g < goS; g++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			local := make(map[int]int)
+			for i := 0; i < perGo; i++ {
+				v, err := q.Take(ctx)
+				assert.NoError(t, err)
+				local[v]++
+			}
+			mu.Lock()
+			for k, v := range local {
+				counts[k] += v
+			}
+			mu.Unlock()
+		}()
+	}
+	for g := 0; g < goS; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGo; i++ {
+				assert.NoError(t, q.Put(ctx, g*perGo+i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	readers.Wait()
+	// 每个对象只被读取一次
+	assert.Len(t, counts, goS*perGo)
+	for _, c := range counts {
+		assert.Equal(t, 1, c)
+	}
+	assert.Equal(t, uint64(0), q.Size())
+}
+
+func TestQueueContext(t *testing.T) {
+	q := NewQueue[int](2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := q.Take(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.True(t, q.Offer(1))
+	assert.True(t, q.Offer(2))
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel2()
+	}()
+	assert.ErrorIs(t, q.Put(ctx2, 3), context.Canceled)
+
+	// 读取后唤醒等待写入的g
+	done := make(chan error)
+	go func() {
+		done <- q.Put(context.Background(), 3)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	v, ok := q.Poll()
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.NoError(t, <-done)
+}
+
+func BenchmarkQueue(b *testing.B) {
+	q := NewQueue[uint64](1024)
+	ctx := context.Background()
+	benchmarkMPMC(b, func(v uint64) { _ = q.Put(ctx, v) }, func() { _, _ = q.Take(ctx) })
+}
+
+func BenchmarkQueueChan(b *testing.B) {
+	ch := make(chan uint64, 1024)
+	benchmarkMPMC(b, func(v uint64) { ch <- v }, func() { <-ch })
+}
+
+// benchmarkMPMC 4个生产者和4个消费者共读写b.N个对象
+func benchmarkMPMC(b *testing.B, put func(v uint64), take func()) {
+	var (
+		goS = 4
+		wg  sync.WaitGroup
+	)
+	b.ResetTimer()
+	for g := 0; g < goS; g++ {
+		n := b.N / goS
+		if g == 0 {
+			n += b.N % goS
+		}
+		wg.Add(2)
+		go func(n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				put(uint64(i))
+			}
+		}(n)
+		go func(n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				take()
+			}
+		}(n)
+	}
+	wg.Wait()
+}
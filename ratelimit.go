@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// maxThrottleWait 限流时单次等待的最大时间，超过时分多次等待，以便及时响应关闭
+const maxThrottleWait = 10 * time.Millisecond
+
+// rateLimit 限流配置
+type rateLimit struct {
+	rate  float64 // 每秒产生的令牌数量
+	burst int     // 令牌桶的容量
+}
+
+// WithRateLimit 设置消费端限流，rate为每秒最多处理的事件数量，burst为允许的突发数量（令牌桶的容量），
+// 超过速率时消费端暂停处理，事件会保留在buffer中，buffer写满后生产者按照阻塞策略等待，即限流会反压到 Producer.Write；
+// 限流状态可以通过 Lockfree.Stats 获取
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *options) {
+		o.rateLimit = &rateLimit{rate: rate, burst: burst}
+	}
+}
+
+// tokenBucket 令牌桶，令牌的获取只由消费端的g调用，统计信息可以被其他g读取
+type tokenBucket struct {
+	rate      float64
+	burst     float64
+	tokens    float64
+	last      time.Time
+	throttled int32  // 当前是否因限流而等待
+	waits     uint64 // 因限流而等待的次数
+	waited    int64  // 因限流而等待的总时间（纳秒）
+}
+
+func newTokenBucket(limit *rateLimit) *tokenBucket {
+	if limit == nil {
+		return nil
+	}
+	return &tokenBucket{
+		rate:   limit.rate,
+		burst:  float64(limit.burst),
+		tokens: float64(limit.burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve 获取一个令牌，获取成功时返回0，否则返回需要等待的时间
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// wait 等待直到获取到令牌，closed返回true时不再等待
+func (b *tokenBucket) wait(closed func() bool) {
+	wait := b.reserve(time.Now())
+	if wait <= 0 {
+		return
+	}
+	start := time.Now()
+	atomic.StoreInt32(&b.throttled, 1)
+	atomic.AddUint64(&b.waits, 1)
+	for wait > 0 && !closed() {
+		if wait > maxThrottleWait {
+			wait = maxThrottleWait
+		}
+		time.Sleep(wait)
+		wait = b.reserve(time.Now())
+	}
+	atomic.StoreInt32(&b.throttled, 0)
+	atomic.AddInt64(&b.waited, int64(time.Since(start)))
+}
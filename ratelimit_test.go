@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(&rateLimit{rate: 10, burst: 2})
+	now := b.last
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	assert.Equal(t, 100*time.Millisecond, b.reserve(now))
+	// 50ms后产生半个令牌
+	assert.Equal(t, 50*time.Millisecond, b.reserve(now.Add(50*time.Millisecond)))
+	assert.Equal(t, time.Duration(0), b.reserve(now.Add(100*time.Millisecond)))
+	// 令牌数量不超过容量
+	assert.Equal(t, time.Duration(0), b.reserve(now.Add(time.Hour)))
+	assert.Equal(t, time.Duration(0), b.reserve(now.Add(time.Hour)))
+	assert.Equal(t, 100*time.Millisecond, b.reserve(now.Add(time.Hour)))
+}
+
+func TestRateLimit(t *testing.T) {
+	h := &countEventHandler[int]{}
+	l, err := New[int](h, WithCapacity(4), WithRateLimit(200, 1))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	start := time.Now()
+	// 容量为4，限流后buffer写满，生产者需要等待消费端
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, l.Producer().Write(i))
+	}
+	assert.True(t, time.Since(start) >= 70*time.Millisecond)
+	assert.True(t, l.Stats().Throttled || h.load() < 20)
+
+	assert.Eventually(t, func() bool {
+		return h.load() == 20
+	}, 5*time.Second, time.Millisecond)
+	assert.True(t, time.Since(start) >= 95*time.Millisecond)
+	stats := l.Stats()
+	assert.Equal(t, uint64(20), stats.Written)
+	assert.Equal(t, uint64(20), stats.Consumed)
+	assert.Equal(t, uint64(0), stats.Pending)
+	assert.True(t, stats.ThrottleWaits > 0)
+	assert.True(t, stats.ThrottleTime > 0)
+}
+
+func TestRateLimitOptions(t *testing.T) {
+	h := &countEventHandler[int]{}
+	_, err := New[int](h, WithRateLimit(0, 1))
+	assert.Error(t, err)
+	_, err = New[int](h, WithRateLimit(10, 0))
+	assert.Error(t, err)
+
+	l, err := New[int](h)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{}, l.Stats())
+}
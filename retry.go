@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import "time"
+
+// RetryPolicy 重试策略，事件处理器panic时由消费端按照该策略重新处理，通过 WithRetry 设置
+// 重试期间消费端会等待，不会处理后续的事件，以保证事件的处理顺序；消费端关闭时会停止等待并不再重试
+type RetryPolicy struct {
+	MaxAttempts int           // 最大处理次数（包含第一次），小于等于1时不重试
+	Backoff     time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxBackoff  time.Duration // 等待时间的上限，为0时不限制
+}
+
+// next 计算下一次重试前的等待时间
+func (p *RetryPolicy) next(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if p.MaxBackoff > 0 && (backoff > p.MaxBackoff || backoff <= 0) {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+// pause 重试前等待d，分多次等待以便及时响应关闭，消费端已关闭时返回false
+func (c *consumer[T]) pause(d time.Duration) bool {
+	for d > 0 && !c.closed() {
+		wait := d
+		if wait > maxThrottleWait {
+			wait = maxThrottleWait
+		}
+		time.Sleep(wait)
+		d -= wait
+	}
+	return !c.closed()
+}
+
+// DeadLetter 死信，重试耗尽后仍处理失败的事件
+type DeadLetter[T any] struct {
+	Value    T
+	Sequence uint64 // 事件对应的序号
+	Err      error  // 最后一次处理的错误
+	Attempts int    // 处理次数
+}
+
+// deadLetterFunc 死信的处理方式，由 WithDeadLetterHandler 或 WithDeadLetterQueue 设置
+type deadLetterFunc[T any] func(d DeadLetter[T]) error
+
+// WithRetry 设置重试策略，参考 RetryPolicy，重试耗尽后交由死信处理，未设置死信时交由异常处理器处理，
+// 均未设置时事件处理器的panic会继续抛出；事件处理器为 JournalHandler 时不支持
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = &policy
+	}
+}
+
+// WithDeadLetterHandler 设置死信处理函数，处理失败的事件（重试耗尽后）会交给该函数，而不再交由异常处理器处理
+// 其类型参数需要与Lockfree的事件类型一致，该函数由消费端的g调用
+func WithDeadLetterHandler[T any](handler func(d DeadLetter[T])) Option {
+	return func(o *options) {
+		if handler == nil {
+			o.deadLetter = deadLetterFunc[T](nil)
+			return
+		}
+		o.deadLetter = deadLetterFunc[T](func(d DeadLetter[T]) error {
+			handler(d)
+			return nil
+		})
+	}
+}
+
+// WithDeadLetterQueue 设置死信队列，处理失败的事件（重试耗尽后）会写入该Lockfree，由其事件处理器处理
+// buffer写满时会等待，写入失败（如死信队列已关闭）时交由异常处理器处理，未设置异常处理器时丢弃
+func WithDeadLetterQueue[T any](queue *Lockfree[DeadLetter[T]]) Option {
+	return func(o *options) {
+		if queue == nil {
+			o.deadLetter = deadLetterFunc[T](nil)
+			return
+		}
+		o.deadLetter = deadLetterFunc[T](func(d DeadLetter[T]) error {
+			return queue.Producer().Write(d)
+		})
+	}
+}
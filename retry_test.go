@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyEventHandler 对于值为负数的事件一直panic，其他事件前failures次处理panic
+type flakyEventHandler struct {
+	mu       sync.Mutex
+	failures int
+	attempts map[int]int
+	values   []int
+}
+
+func (h *flakyEventHandler) OnEvent(v int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.attempts[v]++
+	if v < 0 || h.attempts[v] <= h.failures {
+		panic("flaky")
+	}
+	h.values = append(h.values, v)
+}
+
+func (h *flakyEventHandler) snapshot() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]int(nil), h.values...)
+}
+
+func TestRetryPolicyNext(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 5, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	assert.Equal(t, 2*time.Millisecond, p.next(time.Millisecond))
+	assert.Equal(t, 4*time.Millisecond, p.next(2*time.Millisecond))
+	assert.Equal(t, 5*time.Millisecond, p.next(4*time.Millisecond))
+	p.MaxBackoff = 0
+	assert.Equal(t, 8*time.Millisecond, p.next(4*time.Millisecond))
+}
+
+func TestRetry(t *testing.T) {
+	h := &flakyEventHandler{failures: 2, attempts: make(map[int]int)}
+	dh := &collectEventHandler[DeadLetter[int]]{}
+	l, err := New[int](h, WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}),
+		WithDeadLetterHandler[int](dh.OnEvent))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, l.Producer().Write(i))
+	}
+	assert.NoError(t, l.Producer().Write(-1))
+	assert.NoError(t, l.Producer().Write(4))
+	assert.Eventually(t, func() bool {
+		return len(h.snapshot()) == 4
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []int{1, 2, 3, 4}, h.snapshot())
+
+	letters := dh.snapshot()
+	if assert.Len(t, letters, 1) {
+		assert.Equal(t, -1, letters[0].Value)
+		assert.Equal(t, uint64(4), letters[0].Sequence)
+		assert.Equal(t, 3, letters[0].Attempts)
+		assert.EqualError(t, letters[0].Err, "panic: flaky")
+	}
+}
+
+func TestRetryStopsOnClose(t *testing.T) {
+	h := &flakyEventHandler{attempts: make(map[int]int)}
+	dh := &collectEventHandler[DeadLetter[int]]{}
+	l, err := New[int](h, WithRetry(RetryPolicy{MaxAttempts: 100, Backoff: time.Hour}),
+		WithDeadLetterHandler[int](dh.OnEvent))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+
+	assert.NoError(t, l.Producer().Write(-1))
+	assert.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.attempts[-1] == 1
+	}, 5*time.Second, time.Millisecond)
+	// 关闭后立即停止等待，不再重试，交由死信处理
+	assert.NoError(t, l.Close())
+	assert.Eventually(t, func() bool {
+		return len(dh.snapshot()) == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 1, dh.snapshot()[0].Attempts)
+}
+
+func TestDeadLetterQueue(t *testing.T) {
+	dh := &collectEventHandler[DeadLetter[int]]{}
+	dlq, err := New[DeadLetter[int]](dh)
+	assert.NoError(t, err)
+	assert.NoError(t, dlq.Start())
+	defer dlq.Close()
+
+	h := &flakyEventHandler{attempts: make(map[int]int)}
+	eh := &recordExceptionHandler[int]{}
+	l, err := New[int](h, WithDeadLetterQueue[int](dlq), WithExceptionHandler[int](eh))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	assert.NoError(t, l.Producer().Write(-1))
+	assert.NoError(t, l.Producer().Write(1))
+	assert.Eventually(t, func() bool {
+		return len(dh.snapshot()) == 1 && len(h.snapshot()) == 1
+	}, 5*time.Second, time.Millisecond)
+	letters := dh.snapshot()
+	assert.Equal(t, -1, letters[0].Value)
+	assert.Equal(t, 1, letters[0].Attempts)
+
+	// 死信队列关闭后交由异常处理器处理
+	assert.NoError(t, dlq.Close())
+	assert.NoError(t, l.Producer().Write(-2))
+	assert.Eventually(t, func() bool {
+		return eh.len() == 1
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestRetryOptions(t *testing.T) {
+	h := &flakyEventHandler{attempts: make(map[int]int)}
+	_, err := New[int](h, WithRetry(RetryPolicy{}))
+	assert.Error(t, err)
+	_, err = New[int](h, WithRetry(RetryPolicy{MaxAttempts: 2, Backoff: -1}))
+	assert.Error(t, err)
+	_, err = New[int](h, WithDeadLetterHandler[string](func(d DeadLetter[string]) {}))
+	assert.Error(t, err)
+	_, err = New[int](h, WithDeadLetterHandler[int](nil))
+	assert.Error(t, err)
+	_, err = NewBus[int](1, WithRetry(RetryPolicy{MaxAttempts: 2}))
+	assert.Error(t, err)
+}
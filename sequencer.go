@@ -36,3 +36,9 @@ func (s *sequencer) nextRead() uint64 {
 func (s *sequencer) readIncrement() uint64 {
 	return atomic.AddUint64(&s.rc, 1)
 }
+
+// continueFrom 从指定的序号继续，即下一个写入及读取的序号均为last+1，仅能在未写入任何数据时调用
+func (s *sequencer) continueFrom(last uint64) {
+	atomic.StoreUint64(&s.wc.v, last)
+	atomic.StoreUint64(&s.rc, last+1)
+}
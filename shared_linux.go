@@ -0,0 +1,298 @@
+//go:build !386
+
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	sharedMagic   = 0x6c6f636b66726565 // "lockfree"
+	sharedVersion = 1
+	sharedAlign   = 64 // buffer在文件中的起始位置按照缓存行对齐
+	sharedYield   = 64 // 让出cpu的次数，超过后开始休眠
+	sharedSleep   = 100 * time.Microsecond
+)
+
+// sharedMeta 共享内存文件头，位于文件起始位置，游标与 cursor 一样使用缓存行填充
+type sharedMeta struct {
+	magic    uint64 // 初始化完成后写入，打开时用于判断文件是否可用
+	version  uint64
+	capacity uint64
+	size     uint64 // 每个位置（e[T]）的字节数，用于校验两端的事件类型是否一致
+	_        [4]uint64
+	wc       cursor // 写入游标
+	rc       cursor // 读取游标，即下一个要读取的序号
+}
+
+// SharedRing 基于mmap的跨进程buffer，一个进程通过 CreateSharedRing 创建并写入，另一个进程通过 OpenSharedRing 打开并读取，
+// 适用于同一台机器上的进程间通信，文件一般放在/dev/shm下以避免落盘。
+// 事件类型T必须是定长且不包含指针的类型（如数值、数组及仅由它们组成的结构体），且两端的定义必须完全一致；
+// 生产端可以有多个g（或进程）并发写入，消费端同一时刻只能有一个g读取。
+// 由于无法跨进程唤醒，buffer写满或者读取不到事件时，会通过自旋和休眠的方式等待
+type SharedRing[T any] struct {
+	mu       sync.RWMutex // 保护映射的内存，Close 需要等待所有读写完成后才能解除映射
+	status   int32
+	data     []byte
+	meta     *sharedMeta
+	rbuf     *ringBuffer[T]
+	capacity uint64
+}
+
+// CreateSharedRing 创建容量为capacity（会调整为2^n）的共享buffer，path已存在时会被覆盖
+func CreateSharedRing[T any](path string, capacity int) (*SharedRing[T], error) {
+	if err := checkSharedType[T](); err != nil {
+		return nil, err
+	}
+	n, err := NextPowerOfTwo(capacity)
+	if err != nil {
+		return nil, err
+	}
+	size, err := sharedFileSize[T](uint64(n))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err = f.Truncate(int64(size)); err != nil {
+		return nil, err
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	meta := (*sharedMeta)(unsafe.Pointer(&data[0]))
+	meta.version = sharedVersion
+	meta.capacity = uint64(n)
+	meta.size = uint64(unsafe.Sizeof(e[T]{}))
+	meta.rc.v = 1
+	// 最后写入magic，保证打开方看到magic时其余字段均已初始化
+	atomic.StoreUint64(&meta.magic, sharedMagic)
+	return newSharedRing[T](data), nil
+}
+
+// OpenSharedRing 打开由 CreateSharedRing 创建的共享buffer，文件头与事件类型T不一致时返回 ErrInvalidConfig
+func OpenSharedRing[T any](path string) (*SharedRing[T], error) {
+	if err := checkSharedType[T](); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(unsafe.Sizeof(sharedMeta{})) {
+		return nil, configError("shared ring %s is too small", path)
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	meta := (*sharedMeta)(unsafe.Pointer(&data[0]))
+	if err = checkSharedMeta[T](meta, uint64(len(data))); err != nil {
+		_ = syscall.Munmap(data)
+		return nil, fmt.Errorf("open shared ring %s: %w", path, err)
+	}
+	return newSharedRing[T](data), nil
+}
+
+func newSharedRing[T any](data []byte) *SharedRing[T] {
+	meta := (*sharedMeta)(unsafe.Pointer(&data[0]))
+	capacity := meta.capacity
+	// buffer直接使用映射的内存，复用ringBuffer的读写逻辑
+	buf := unsafe.Slice((*e[T])(unsafe.Pointer(&data[sharedOffset()])), capacity)
+	return &SharedRing[T]{
+		status: RUNNING,
+		data:   data,
+		meta:   meta,
+		rbuf: &ringBuffer[T]{
+			buf:     buf,
+			capMask: capacity - 1,
+		},
+		capacity: capacity,
+	}
+}
+
+// Write 写入事件，buffer已满时会一直等待消费端读取，直到可以写入或者被关闭
+func (r *SharedRing[T]) Write(v T) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed() {
+		return writeError("SharedRing", 0, ErrClosed)
+	}
+	next := r.meta.wc.increment()
+	var i = 0
+	for {
+		if next <= atomic.LoadUint64(&r.meta.rc.v)-1+r.capacity {
+			r.rbuf.write(next-1, v)
+			return nil
+		}
+		if !r.wait(i) {
+			// 序号已被占用，关闭后消费端将无法继续读取该序号之后的事件
+			return writeError("SharedRing", next, ErrClosed)
+		}
+		i++
+	}
+}
+
+// Read 读取下一个事件，没有可读取的事件时立即返回false，仅能由一个g调用
+func (r *SharedRing[T]) Read() (T, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed() {
+		return r.rbuf.tDefault, false, &QueueError{Name: "SharedRing", Op: "read", Err: ErrClosed}
+	}
+	v, ok := r.read()
+	return v, ok, nil
+}
+
+// Handle 循环读取事件并交给handler处理，直到 Close 被调用后返回 ErrClosed，仅能由一个g调用
+func (r *SharedRing[T]) Handle(handler EventHandler[T]) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var i = 0
+	for {
+		if v, ok := r.read(); ok {
+			handler.OnEvent(v)
+			i = 0
+			continue
+		}
+		if !r.wait(i) {
+			return &QueueError{Name: "SharedRing", Op: "read", Err: ErrClosed}
+		}
+		i++
+	}
+}
+
+func (r *SharedRing[T]) read() (T, bool) {
+	rc := atomic.LoadUint64(&r.meta.rc.v)
+	v, _, ok := r.rbuf.contains(rc - 1)
+	if ok {
+		// 读取完成后再推进读取游标，防止该位置在读取过程中被覆盖
+		atomic.StoreUint64(&r.meta.rc.v, rc+1)
+	}
+	return v, ok
+}
+
+// wait 第i次等待，先自旋后休眠，已关闭时返回false
+func (r *SharedRing[T]) wait(i int) bool {
+	if r.closed() {
+		return false
+	}
+	if i < spin {
+		procyield(30)
+	} else if i < spin+sharedYield {
+		runtime.Gosched()
+	} else {
+		time.Sleep(sharedSleep)
+	}
+	return true
+}
+
+// Cap 容量
+func (r *SharedRing[T]) Cap() uint64 {
+	return r.capacity
+}
+
+// Close 解除内存映射，会等待正在进行的读写返回，文件本身不会被删除
+func (r *SharedRing[T]) Close() error {
+	if !atomic.CompareAndSwapInt32(&r.status, RUNNING, READY) {
+		return closeError("SharedRing")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return syscall.Munmap(r.data)
+}
+
+func (r *SharedRing[T]) closed() bool {
+	return atomic.LoadInt32(&r.status) == READY
+}
+
+// sharedOffset buffer在文件中的起始位置
+func sharedOffset() uintptr {
+	return (unsafe.Sizeof(sharedMeta{}) + sharedAlign - 1) &^ (sharedAlign - 1)
+}
+
+// sharedFileSize 计算容量为capacity的共享文件大小
+func sharedFileSize[T any](capacity uint64) (uint64, error) {
+	size := uint64(unsafe.Sizeof(e[T]{}))
+	if size != 0 && capacity > (uint64(maxCapacity)-uint64(sharedOffset()))/size {
+		return 0, configError("shared ring capacity %d is too large", capacity)
+	}
+	return uint64(sharedOffset()) + size*capacity, nil
+}
+
+// checkSharedMeta 校验文件头与事件类型及文件大小是否一致
+func checkSharedMeta[T any](meta *sharedMeta, length uint64) error {
+	if atomic.LoadUint64(&meta.magic) != sharedMagic {
+		return configError("shared ring is not initialized")
+	}
+	if meta.version != sharedVersion {
+		return configError("shared ring version %d mismatch", meta.version)
+	}
+	if meta.size != uint64(unsafe.Sizeof(e[T]{})) {
+		return configError("shared ring element size %d mismatch", meta.size)
+	}
+	if meta.capacity == 0 || !isPowerOfTwo(int(meta.capacity)) {
+		return configError("shared ring capacity %d is invalid", meta.capacity)
+	}
+	size, err := sharedFileSize[T](meta.capacity)
+	if err != nil {
+		return err
+	}
+	if length < size {
+		return configError("shared ring is truncated")
+	}
+	return nil
+}
+
+// checkSharedType 校验事件类型是否可以放在共享内存中，即定长且不包含指针
+func checkSharedType[T any]() error {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if !isPointerFree(t) {
+		return configError("type %s is not fixed-size and pointer-free", t)
+	}
+	return nil
+}
+
+func isPointerFree(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isPointerFree(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !isPointerFree(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	// 字符串、切片、map、指针、接口、chan、函数及uintptr等在其他进程中均无意义
+	return false
+}
@@ -0,0 +1,122 @@
+//go:build !386
+
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sharedEvent struct {
+	ID    uint64
+	Price float64
+	Tags  [4]uint16
+}
+
+func TestSharedRing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	writer, err := CreateSharedRing[sharedEvent](path, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(8), writer.Cap())
+	// 两次映射同一个文件，模拟两个进程
+	reader, err := OpenSharedRing[sharedEvent](path)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(8), reader.Cap())
+
+	_, ok, err := reader.Read()
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	var (
+		goS   = 4
+		perGo = 1000
+		wg    sync.WaitGroup
+	)
+	for g := 0; g < goS; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGo; i++ {
+				v := sharedEvent{ID: uint64(g*perGo + i), Price: float64(i), Tags: [4]uint16{uint16(g)}}
+				assert.NoError(t, writer.Write(v))
+			}
+		}(g)
+	}
+	// 每个生产者写入的事件保持顺序
+	last := make([]int, goS)
+	for i := range last {
+		last[i] = -1
+	}
+	for n := 0; n < goS*perGo; {
+		v, ok, err := reader.Read()
+		assert.NoError(t, err)
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		g := int(v.Tags[0])
+		i := int(v.ID) - g*perGo
+		assert.Equal(t, last[g]+1, i)
+		assert.Equal(t, float64(i), v.Price)
+		last[g] = i
+		n++
+	}
+	wg.Wait()
+
+	// Handle 在关闭后返回
+	h := &countEventHandler[sharedEvent]{}
+	done := make(chan error)
+	go func() {
+		done <- reader.Handle(h)
+	}()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, writer.Write(sharedEvent{ID: uint64(i)}))
+	}
+	assert.Eventually(t, func() bool { return h.load() == 100 }, time.Second, time.Millisecond)
+	assert.NoError(t, reader.Close())
+	assert.ErrorIs(t, <-done, ClosedError)
+	assert.Error(t, reader.Close())
+
+	// 消费端关闭后buffer写满，生产者在关闭时返回
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, writer.Write(sharedEvent{}))
+	}
+	go func() {
+		done <- writer.Write(sharedEvent{})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, writer.Close())
+	assert.ErrorIs(t, <-done, ClosedError)
+	assert.ErrorIs(t, writer.Write(sharedEvent{}), ClosedError)
+}
+
+func TestSharedRingInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	_, err := CreateSharedRing[string](path, 8)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = CreateSharedRing[struct{ p *int }](path, 8)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = CreateSharedRing[[2][]byte](path, 8)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	r, err := CreateSharedRing[uint64](path, 8)
+	assert.NoError(t, err)
+	defer r.Close()
+	// 事件类型大小不一致
+	_, err = OpenSharedRing[sharedEvent](path)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = OpenSharedRing[uint64](filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
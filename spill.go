@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+const spillFileName = "spill.data"
+
+// spillConfig 溢出配置
+type spillConfig[T any] struct {
+	dir      string
+	codec    Codec[T]
+	maxBytes int64
+}
+
+// WithSpill 设置溢出模式，buffer已满（WriteWindow() <= 0）时，Write 会将事件追加到dir目录下的本地文件中，而不是阻塞等待；
+// 溢出的事件同样会占用序号，消费端读取到该序号时会从文件中读取，因此buffer和文件中的事件严格按照序号（先进先出）顺序处理。
+// maxBytes为溢出文件的最大字节数，超过后 Write 退化为阻塞等待buffer，溢出的事件全部处理完成后文件会被清空。
+// 溢出文件仅用于缓冲，不保证持久化，创建时会清空已有的溢出文件。其类型参数需要与Lockfree的事件类型一致
+func WithSpill[T any](dir string, codec Codec[T], maxBytes int64) Option {
+	return func(o *options) {
+		o.spill = &spillConfig[T]{
+			dir:      dir,
+			codec:    codec,
+			maxBytes: maxBytes,
+		}
+	}
+}
+
+// spillQueue 溢出队列，基于本地文件实现，写入和读取均在锁内完成
+type spillQueue[T any] struct {
+	mu       sync.Mutex
+	codec    Codec[T]
+	maxBytes int64
+	w        *os.File
+	rf       *os.File
+	r        *bufio.Reader
+	written  int64  // 文件当前的大小
+	count    int64  // 尚未被读取的事件数量
+	buf      []byte // 编码缓冲区
+	rbuf     []byte // 读取缓冲区
+	head     uint64 // 已读取但尚未被取走的事件的序号，0表示不存在
+	headV    T
+	headErr  error
+}
+
+func newSpillQueue[T any](config *spillConfig[T]) (*spillQueue[T], error) {
+	if err := os.MkdirAll(config.dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(config.dir, spillFileName)
+	w, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	rf, err := os.Open(path)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return &spillQueue[T]{
+		codec:    config.codec,
+		maxBytes: config.maxBytes,
+		w:        w,
+		rf:       rf,
+		r:        bufio.NewReader(rf),
+	}, nil
+}
+
+// offer 将事件写入溢出文件，increment用于获取序号，在锁内调用以保证文件中的事件按照序号顺序排列
+// 返回值：获取到的序号、是否已写入文件及编码错误；文件已满时不会获取序号，
+// 获取到序号但写入文件失败时，调用方需要将事件写入buffer中对应的位置
+func (s *spillQueue[T]) offer(v T, increment func() uint64) (uint64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	// 先编码以确认文件是否还有空间，之后再获取序号
+	if s.buf, err = appendRecord(s.buf[:0], 0, v, s.codec); err != nil {
+		return 0, false, err
+	}
+	if s.written+int64(len(s.buf)) > s.maxBytes {
+		return 0, false, nil
+	}
+	next := increment()
+	setRecordSeq(s.buf, next)
+	if _, err = s.w.Write(s.buf); err != nil {
+		// 恢复到写入前的状态，防止残留不完整的记录
+		_ = s.w.Truncate(s.written)
+		return next, false, nil
+	}
+	s.written += int64(len(s.buf))
+	atomic.AddInt64(&s.count, 1)
+	return next, true, nil
+}
+
+// size 尚未被读取的事件数量
+func (s *spillQueue[T]) size() int64 {
+	return atomic.LoadInt64(&s.count)
+}
+
+// take 读取序号为seq的事件，仅由消费端调用
+// 文件中的第一个事件不是seq时返回false，表示该序号的事件在buffer中；
+// 解码失败时返回true及error，该事件同样会被取走；读取文件失败时返回false及error，此时无法继续处理
+func (s *spillQueue[T]) take(seq uint64) (T, bool, error) {
+	var zero T
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.head == 0 {
+		if atomic.LoadInt64(&s.count) == 0 {
+			return zero, false, nil
+		}
+		var payload []byte
+		var err error
+		s.head, payload, s.rbuf, err = readRecord(s.r, s.rbuf, s.written)
+		if err != nil {
+			// 文件中的记录均是完整写入的，读取失败只可能是文件被外部修改或者磁盘异常，无法恢复
+			s.head = 0
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return zero, false, err
+		}
+		s.headV, s.headErr = s.codec.Decode(payload)
+	}
+	if s.head != seq {
+		return zero, false, nil
+	}
+	v, err := s.headV, s.headErr
+	s.headV = zero
+	s.head = 0
+	if atomic.AddInt64(&s.count, -1) == 0 {
+		s.clear()
+	}
+	return v, true, err
+}
+
+// clear 清空溢出文件
+func (s *spillQueue[T]) clear() {
+	atomic.StoreInt64(&s.count, 0)
+	s.head = 0
+	s.written = 0
+	_ = s.w.Truncate(0)
+	_, _ = s.rf.Seek(0, io.SeekStart)
+	s.r.Reset(s.rf)
+}
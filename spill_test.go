@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpill(t *testing.T) {
+	for _, blocks := range []blockStrategy{NewChanBlockStrategy(), NewConditionBlockStrategy(), NewSleepBlockStrategy(time.Millisecond)} {
+		h := newGateEventHandler[journalEntry]()
+		lf, err := New[journalEntry](h, WithCapacity(4), WithWaitStrategy(blocks),
+			WithSpill[journalEntry](t.TempDir(), JSONCodec[journalEntry]{}, 1<<20))
+		assert.NoError(t, err)
+		assert.NoError(t, lf.Start())
+		producer := lf.Producer()
+		// 消费端阻塞时写入远超容量的事件，不应阻塞
+		for i := 1; i <= 100; i++ {
+			assert.NoError(t, producer.Write(journalEntry{ID: uint64(i)}))
+		}
+		assert.Greater(t, lf.writer.spill.size(), int64(0))
+		close(h.gate)
+		assert.Eventually(t, func() bool { return h.count() == 100 }, 5*time.Second, time.Millisecond)
+		// 消费端空闲后继续写入，buffer与溢出文件交替使用
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					assert.NoError(t, producer.Write(journalEntry{}))
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Eventually(t, func() bool { return h.count() == 500 }, 5*time.Second, time.Millisecond)
+		for i, seq := range h.sequences() {
+			assert.Equal(t, uint64(i+1), seq)
+		}
+		for i, v := range h.snapshot()[:100] {
+			assert.Equal(t, uint64(i+1), v.ID)
+		}
+		assert.Equal(t, int64(0), lf.writer.spill.size())
+		assert.NoError(t, lf.Close())
+	}
+}
+
+func TestSpillFull(t *testing.T) {
+	h := newGateEventHandler[journalEntry]()
+	// 溢出文件仅能容纳少量事件
+	lf, err := New[journalEntry](h, WithCapacity(2),
+		WithSpill[journalEntry](t.TempDir(), JSONCodec[journalEntry]{}, 128))
+	assert.NoError(t, err)
+	assert.NoError(t, lf.Start())
+	producer := lf.Producer()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 20; i++ {
+			assert.NoError(t, producer.Write(journalEntry{ID: uint64(i)}))
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatal("write should block when spill is full")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(h.gate)
+	<-done
+	assert.Eventually(t, func() bool { return h.count() == 20 }, 5*time.Second, time.Millisecond)
+	seqs := h.sequences()
+	for i, v := range h.snapshot() {
+		assert.Equal(t, uint64(i+1), v.ID)
+		assert.Equal(t, uint64(i+1), seqs[i])
+	}
+	assert.NoError(t, lf.Close())
+
+	_, err = New[journalEntry](h, WithSpill[order]("", JSONCodec[order]{}, 128))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = New[journalEntry](h, WithSpill[journalEntry]("", JSONCodec[journalEntry]{}, 128))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// spscIndex 单个g维护的位置，与cursor一样使用缓存行填充，
+// 同时缓存对端的位置，只有缓存的位置无法满足时才读取对端的位置，减少对对端缓存行的访问
+type spscIndex struct {
+	p1, p2, p3, p4, p5, p6, p7   uint64
+	v                            uint64 // 自身的位置，只由自身修改，通过原子写保证对端可见
+	cache                        uint64 // 对端位置的缓存，只由自身访问
+	p10, p11, p12, p13, p14, p15 uint64
+}
+
+// SPSC 单生产者单消费者队列，同一时刻只能有一个g写入及一个g读取，Offer和Poll均为wait-free
+// 创建时指定了事件处理器时，Start后由内部的g读取并交给事件处理器处理，此时不能再调用Poll，用法与Lockfree一致；
+// 未指定事件处理器时由调用方通过Poll读取
+type SPSC[T any] struct {
+	tDefault T
+	buf      []T
+	capMask  uint64
+	head     *spscIndex // 写入位置，cache为读取位置的缓存
+	tail     *spscIndex // 读取位置，cache为写入位置的缓存
+	hdl      EventHandler[T]
+	blocks   blockStrategy
+	status   int32
+	closed   int32
+}
+
+// NewSPSC 创建单生产者单消费者队列，capacity要求是2^n，如果不是的话会被修改
+// handler：事件处理器，为nil时由调用方通过Poll读取
+// blocks：设置了事件处理器时，读取阻塞时的处理策略
+// 该方法不会对参数进行校验，设置了事件处理器时blocks不能为nil
+func NewSPSC[T any](capacity int, handler EventHandler[T], blocks blockStrategy) *SPSC[T] {
+	capacity = minSuitableCap(capacity)
+	return &SPSC[T]{
+		buf:     make([]T, capacity),
+		capMask: uint64(capacity) - 1,
+		head:    &spscIndex{},
+		tail:    &spscIndex{},
+		hdl:     handler,
+		blocks:  blocks,
+		status:  READY,
+	}
+}
+
+// Offer 写入对象，队列已满时返回false，只能由一个g调用
+func (q *SPSC[T]) Offer(v T) bool {
+	h := q.head.v
+	if h-q.head.cache > q.capMask {
+		// 缓存的读取位置无法满足，重新读取
+		q.head.cache = atomic.LoadUint64(&q.tail.v)
+		if h-q.head.cache > q.capMask {
+			return false
+		}
+	}
+	q.buf[h&q.capMask] = v
+	atomic.StoreUint64(&q.head.v, h+1)
+	if q.hdl != nil {
+		q.blocks.release()
+	}
+	return true
+}
+
+// Write 写入对象，队列已满时会一直等待，直到写入成功或者关闭，只能由一个g调用
+func (q *SPSC[T]) Write(v T) error {
+	for {
+		if atomic.LoadInt32(&q.closed) == 1 {
+			return writeError("SPSC", 0, ErrClosed)
+		}
+		if q.Offer(v) {
+			return nil
+		}
+		runtime.Gosched()
+	}
+}
+
+// Poll 读取对象，队列为空时返回false，只能由一个g调用，设置了事件处理器时不能调用
+func (q *SPSC[T]) Poll() (T, bool) {
+	t := q.tail.v
+	if t == q.tail.cache {
+		// 缓存的写入位置无法满足，重新读取
+		q.tail.cache = atomic.LoadUint64(&q.head.v)
+		if t == q.tail.cache {
+			return q.tDefault, false
+		}
+	}
+	x := &q.buf[t&q.capMask]
+	v := *x
+	// 清理引用，防止对象无法被回收
+	*x = q.tDefault
+	atomic.StoreUint64(&q.tail.v, t+1)
+	return v, true
+}
+
+// Size 队列中对象的数量，由于执行时不加锁，该结果是不可靠的
+func (q *SPSC[T]) Size() uint64 {
+	t := atomic.LoadUint64(&q.tail.v)
+	return atomic.LoadUint64(&q.head.v) - t
+}
+
+// Cap 容量
+func (q *SPSC[T]) Cap() uint64 {
+	return q.capMask + 1
+}
+
+// Start 启动内部的g读取并处理事件，未设置事件处理器时直接返回
+func (q *SPSC[T]) Start() error {
+	if atomic.CompareAndSwapInt32(&q.status, READY, RUNNING) {
+		atomic.StoreInt32(&q.closed, 0)
+		if q.hdl != nil {
+			go q.handle()
+		}
+		return nil
+	}
+	return startError("SPSC")
+}
+
+func (q *SPSC[T]) handle() {
+	var i = 0
+	for {
+		if atomic.LoadInt32(&q.status) == READY {
+			return
+		}
+		if v, ok := q.Poll(); ok {
+			q.hdl.OnEvent(v)
+			i = 0
+			continue
+		}
+		if i < spin {
+			procyield(30)
+		} else if i < spin+passiveSpin {
+			runtime.Gosched()
+		} else {
+			// 等待写入位置推进到读取位置之后
+			q.blocks.block(&q.head.v, q.tail.v+1)
+			i = 0
+		}
+		i++
+	}
+}
+
+func (q *SPSC[T]) Running() bool {
+	return atomic.LoadInt32(&q.status) == RUNNING
+}
+
+// Close 关闭，关闭后 Write 返回 ErrClosed，内部的g会退出，未调用 Start 时也可以关闭
+func (q *SPSC[T]) Close() error {
+	if !atomic.CompareAndSwapInt32(&q.closed, 0, 1) {
+		return closeError("SPSC")
+	}
+	if atomic.CompareAndSwapInt32(&q.status, RUNNING, READY) && q.hdl != nil {
+		// 防止阻塞无法释放
+		q.blocks.release()
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSPSCOfferPoll(t *testing.T) {
+	q := NewSPSC[int](4, nil, nil)
+	_, ok := q.Poll()
+	assert.False(t, ok)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 4; i++ {
+			assert.True(t, q.Offer(round*4+i))
+		}
+		assert.False(t, q.Offer(-1))
+		assert.Equal(t, uint64(4), q.Size())
+		for i := 0; i < 4; i++ {
+			v, ok := q.Poll()
+			assert.True(t, ok)
+			assert.Equal(t, round*4+i, v)
+		}
+		_, ok = q.Poll()
+		assert.False(t, ok)
+	}
+
+	// 一个g写入，一个g读取
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10000; i++ {
+			assert.NoError(t, q.Write(i))
+		}
+	}()
+	for i := 0; i < 10000; {
+		if v, ok := q.Poll(); ok {
+			assert.Equal(t, i, v)
+			i++
+		} else {
+			runtime.Gosched()
+		}
+	}
+	<-done
+	assert.NoError(t, q.Close())
+	assert.ErrorIs(t, q.Write(1), ClosedError)
+	assert.Error(t, q.Close())
+}
+
+func TestSPSCHandler(t *testing.T) {
+	for _, blocks := range []blockStrategy{NewChanBlockStrategy(), NewConditionBlockStrategy(), NewSleepBlockStrategy(time.Millisecond)} {
+		h := &collectEventHandler[int]{}
+		q := NewSPSC[int](8, h, blocks)
+		assert.NoError(t, q.Start())
+		assert.True(t, q.Running())
+		for i := 0; i < 1000; i++ {
+			assert.NoError(t, q.Write(i))
+		}
+		assert.Eventually(t, func() bool { return len(h.snapshot()) == 1000 }, 5*time.Second, time.Millisecond)
+		for i, v := range h.snapshot() {
+			assert.Equal(t, i, v)
+		}
+		assert.NoError(t, q.Close())
+		assert.False(t, q.Running())
+	}
+}
+
+func BenchmarkSPSC(b *testing.B) {
+	q := NewSPSC[uint64](1024, nil, nil)
+	benchmarkSPSC(b, func(v uint64) { _ = q.Write(v) }, func() bool { _, ok := q.Poll(); return ok })
+}
+
+func BenchmarkSPSCChan(b *testing.B) {
+	ch := make(chan uint64, 1024)
+	benchmarkSPSC(b, func(v uint64) { ch <- v }, func() bool { <-ch; return true })
+}
+
+// benchmarkSPSC 一个生产者和一个消费者读写b.N个对象
+func benchmarkSPSC(b *testing.B, put func(v uint64), take func() bool) {
+	done := make(chan struct{})
+	b.ResetTimer()
+	go func() {
+		defer close(done)
+		for i := 0; i < b.N; {
+			if take() {
+				i++
+			} else {
+				runtime.Gosched()
+			}
+		}
+	}()
+	for i := 0; i < b.N; i++ {
+		put(uint64(i))
+	}
+	<-done
+}
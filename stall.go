@@ -0,0 +1,118 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// StallPolicy 停滞检测的配置，通过 WithStallWatchdog 设置
+// 消费端等待同一个序号超过Threshold，且之后的序号已写入时认为发生停滞，
+// 通常是因为调用 Producer.WriteTimeout 返回false后没有继续调用 Producer.WriteByCursor
+type StallPolicy struct {
+	Threshold time.Duration // 等待同一个序号的时间阈值，需要大于0
+	// Skip 停滞时是否跳过该序号，仅能跳过 WriteTimeout 超时后未写入的位置，
+	// 跳过后事件处理器不会收到该序号的事件，对该位置调用 WriteByCursor 会返回 ErrInvalidCursor
+	Skip    bool
+	OnStall func(s Stall) // 发生停滞时的回调，由消费端的g调用，可以为nil
+}
+
+// Stall 停滞的信息
+type Stall struct {
+	Sequence uint64        // 消费端等待的序号
+	Written  uint64        // 最后一个已获取的写入序号
+	Duration time.Duration // 已等待的时间
+	Skipped  bool          // 是否已跳过该序号
+}
+
+// WithStallWatchdog 设置停滞检测，参考 StallPolicy，发生停滞的次数可以通过 Stats 获取；
+// 事件处理器为 JournalHandler 时不支持跳过
+func WithStallWatchdog(policy StallPolicy) Option {
+	return func(o *options) {
+		o.stall = &policy
+	}
+}
+
+// stallWatch 消费端的停滞检测，仅由消费端的g操作，统计除外
+type stallWatch struct {
+	policy   StallPolicy
+	skip     func(seq uint64) bool // 放弃该序号的写入，该序号不能跳过时返回false
+	seq      uint64                // 正在等待的序号
+	since    time.Time             // 开始等待的时间
+	check    time.Time             // 下一次检查的时间
+	later    bool                  // 之后的序号是否已写入
+	reported bool                  // 是否已回调
+	stalls   uint64                // 发生停滞的次数
+	skipped  uint64                // 跳过的序号数量
+}
+
+func newStallWatch(policy *StallPolicy, skip func(seq uint64) bool) *stallWatch {
+	if policy == nil {
+		return nil
+	}
+	w := &stallWatch{policy: *policy}
+	if policy.Skip {
+		w.skip = skip
+	}
+	return w
+}
+
+// stalled 检查消费端等待序号rc是否停滞，跳过该序号时推进读取游标并返回true
+func (c *consumer[T]) stalled(rc uint64) bool {
+	w := c.stall
+	if w == nil {
+		return false
+	}
+	now := time.Now()
+	if w.seq != rc {
+		w.seq, w.since, w.check = rc, now, now.Add(w.policy.Threshold)
+		w.later, w.reported = false, false
+		return false
+	}
+	if now.Before(w.check) {
+		return false
+	}
+	w.check = now.Add(w.policy.Threshold)
+	if !w.later && !c.published(rc) {
+		return false
+	}
+	w.later = true
+	// 每个序号只回调一次停滞，跳过时再回调一次
+	first := !w.reported
+	if first {
+		w.reported = true
+		atomic.AddUint64(&w.stalls, 1)
+	}
+	skipped := w.skip != nil && w.skip(rc)
+	if skipped {
+		atomic.AddUint64(&w.skipped, 1)
+		c.seqer.readIncrement()
+		c.pblocks.release()
+	}
+	if w.policy.OnStall != nil && (first || skipped) {
+		w.policy.OnStall(Stall{
+			Sequence: rc,
+			Written:  c.seqer.wc.atomicLoad(),
+			Duration: now.Sub(w.since),
+			Skipped:  skipped,
+		})
+	}
+	return skipped
+}
+
+// published 序号rc之后（buffer范围内）是否有已写入的序号
+func (c *consumer[T]) published(rc uint64) bool {
+	wc := c.seqer.wc.atomicLoad()
+	for s := rc + 1; s <= wc && s < rc+c.rbuf.cap(); s++ {
+		if _, _, ok := c.rbuf.contains(s - 1); ok {
+			return true
+		}
+	}
+	return false
+}
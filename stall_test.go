@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// abandonCursor 写满buffer后调用 WriteTimeout 使其超时，返回未写入的位置，之后再写入一个事件（值为6）
+func abandonCursor(t *testing.T, l *Lockfree[int], h *gateEventHandler[int]) uint64 {
+	p := l.Producer()
+	assert.NoError(t, p.Write(0))
+	<-h.entered
+	for i := 1; i <= 4; i++ {
+		assert.NoError(t, p.Write(i))
+	}
+	wc, ok, err := p.WriteTimeout(5, time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	go func() {
+		assert.NoError(t, p.Write(6))
+	}()
+	close(h.gate)
+	return wc
+}
+
+func TestStallSkip(t *testing.T) {
+	var mu sync.Mutex
+	var stalls []Stall
+	h := newGateEventHandler[int]()
+	l, err := New[int](h, WithCapacity(4), WithStallWatchdog(StallPolicy{
+		Threshold: 20 * time.Millisecond,
+		Skip:      true,
+		OnStall: func(s Stall) {
+			mu.Lock()
+			defer mu.Unlock()
+			stalls = append(stalls, s)
+		},
+	}))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	wc := abandonCursor(t, l, h)
+	assert.Eventually(t, func() bool {
+		return h.count() == 6
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 6}, h.snapshot())
+
+	mu.Lock()
+	if assert.Len(t, stalls, 1) {
+		assert.Equal(t, wc, stalls[0].Sequence)
+		assert.Equal(t, wc+1, stalls[0].Written)
+		assert.True(t, stalls[0].Skipped)
+		assert.True(t, stalls[0].Duration >= 20*time.Millisecond)
+	}
+	mu.Unlock()
+	stats := l.Stats()
+	assert.Equal(t, uint64(1), stats.Stalls)
+	assert.Equal(t, uint64(1), stats.Skipped)
+
+	// 已跳过的位置不能再写入
+	assert.Empty(t, l.Producer().PendingCursors())
+	_, err = l.Producer().WriteByCursor(5, wc)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestStallReport(t *testing.T) {
+	reported := make(chan Stall, 4)
+	h := newGateEventHandler[int]()
+	l, err := New[int](h, WithCapacity(4), WithStallWatchdog(StallPolicy{
+		Threshold: 10 * time.Millisecond,
+		OnStall: func(s Stall) {
+			reported <- s
+		},
+	}))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	wc := abandonCursor(t, l, h)
+	s := <-reported
+	assert.Equal(t, wc, s.Sequence)
+	assert.False(t, s.Skipped)
+	assert.Equal(t, uint64(1), l.Stats().Stalls)
+
+	// 未跳过时继续写入即可恢复，每个序号只回调一次
+	ok, err := l.Producer().WriteByCursor(5, wc)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Eventually(t, func() bool {
+		return h.count() == 7
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6}, h.snapshot())
+	assert.Len(t, reported, 0)
+	assert.Equal(t, uint64(0), l.Stats().Skipped)
+}
+
+func TestStallConfig(t *testing.T) {
+	_, err := New[int](&countEventHandler[int]{}, WithStallWatchdog(StallPolicy{}))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = NewPriority[int](&countEventHandler[int]{}, 2, WithStallWatchdog(StallPolicy{Threshold: time.Second}))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+// EventTranslator 事件转换器，参考LMAX中EventTranslator的设计
+// 生产者获取到写入位置后，会将buffer中对应位置对象的指针及序号交给转换器，由用户直接在该位置上填充对象，
+// 这样不需要先在栈上构造对象再拷贝到buffer中。
+// 注意：slot中保存的是该位置上一轮的对象，转换器需要自行覆盖所有需要的字段；
+// 只有设置了 WithEventFactory（或事件处理器实现了 EventClearer）时，位置才会在上一轮的事件处理完成后释放，
+// 此时才能原地复用该对象引用的内容（如指针指向的对象、切片的底层数组），否则消费端可能仍在处理上一轮的事件，应当赋值新的对象
+// 转换器panic时该位置仍会被发布（与LMAX在finally中发布一致），否则消费端会一直等待该位置，panic会继续抛给调用方
+type EventTranslator[T any] func(slot *T, seq uint64)
+
+// EventTranslatorOneArg 带一个参数的事件转换器
+type EventTranslatorOneArg[T, A any] func(slot *T, seq uint64, a A)
+
+// EventTranslatorTwoArg 带两个参数的事件转换器
+type EventTranslatorTwoArg[T, A, B any] func(slot *T, seq uint64, a A, b B)
+
+// EventTranslatorThreeArg 带三个参数的事件转换器
+type EventTranslatorThreeArg[T, A, B, C any] func(slot *T, seq uint64, a A, b B, c C)
+
+// Publish 通过事件转换器写入对象，写入的等待逻辑与 Write 一致
+func (q *Producer[T]) Publish(translator EventTranslator[T]) error {
+	next, err := q.claim()
+	if err != nil {
+		return err
+	}
+	defer q.publish(next)
+	translator(q.rbuf.slot(next-1), next)
+	return nil
+}
+
+// PublishOneArg 通过带一个参数的事件转换器写入对象
+// 由于go的方法不支持泛型参数，因此带参数的版本均以函数的方式提供，参数直接传递给转换器，避免使用闭包产生内存分配
+func PublishOneArg[T, A any](q *Producer[T], translator EventTranslatorOneArg[T, A], a A) error {
+	next, err := q.claim()
+	if err != nil {
+		return err
+	}
+	defer q.publish(next)
+	translator(q.rbuf.slot(next-1), next, a)
+	return nil
+}
+
+// PublishTwoArg 通过带两个参数的事件转换器写入对象
+func PublishTwoArg[T, A, B any](q *Producer[T], translator EventTranslatorTwoArg[T, A, B], a A, b B) error {
+	next, err := q.claim()
+	if err != nil {
+		return err
+	}
+	defer q.publish(next)
+	translator(q.rbuf.slot(next-1), next, a, b)
+	return nil
+}
+
+// PublishThreeArg 通过带三个参数的事件转换器写入对象
+func PublishThreeArg[T, A, B, C any](q *Producer[T], translator EventTranslatorThreeArg[T, A, B, C], a A, b B, c C) error {
+	next, err := q.claim()
+	if err != nil {
+		return err
+	}
+	defer q.publish(next)
+	translator(q.rbuf.slot(next-1), next, a, b, c)
+	return nil
+}
+
+// publish 发布已填充完成的位置，并释放消费端的阻塞
+func (q *Producer[T]) publish(next uint64) {
+	q.rbuf.publish(next - 1)
+	q.blocks.release()
+}
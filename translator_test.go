@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type order struct {
+	id    uint64
+	price int64
+	qty   int32
+	side  byte
+	seq   uint64
+}
+
+func TestPublishTranslator(t *testing.T) {
+	eh := &collectEventHandler[order]{}
+	disruptor := NewLockfree[order](4, eh, NewChanBlockStrategy())
+	assert.NoError(t, disruptor.Start())
+	producer := disruptor.Producer()
+
+	assert.NoError(t, producer.Publish(func(slot *order, seq uint64) {
+		*slot = order{id: 1, seq: seq}
+	}))
+	assert.NoError(t, PublishOneArg(producer, func(slot *order, seq uint64, id uint64) {
+		*slot = order{id: id, seq: seq}
+	}, 2))
+	assert.NoError(t, PublishTwoArg(producer, func(slot *order, seq uint64, id uint64, price int64) {
+		*slot = order{id: id, price: price, seq: seq}
+	}, 3, 100))
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, PublishThreeArg(producer, func(slot *order, seq uint64, id uint64, price int64, qty int32) {
+			*slot = order{id: id, price: price, qty: qty, seq: seq}
+		}, uint64(4+i), 200, 5))
+	}
+
+	assert.Eventually(t, func() bool {
+		return len(eh.snapshot()) == 13
+	}, time.Second, time.Millisecond)
+	for i, o := range eh.snapshot() {
+		assert.Equal(t, uint64(i+1), o.id)
+		assert.Equal(t, uint64(i+1), o.seq)
+	}
+	assert.NoError(t, disruptor.Close())
+	assert.ErrorIs(t, producer.Publish(func(slot *order, seq uint64) {}), ErrClosed)
+}
+
+func TestPublishTranslatorAllocs(t *testing.T) {
+	eh := &countEventHandler[order]{}
+	disruptor := NewLockfree[order](1024, eh, &SchedBlockStrategy{})
+	assert.NoError(t, disruptor.Start())
+	defer disruptor.Close()
+	producer := disruptor.Producer()
+	translator := func(slot *order, seq uint64, id uint64, price int64) {
+		slot.id = id
+		slot.price = price
+		slot.seq = seq
+	}
+	allocs := testing.AllocsPerRun(1000, func() {
+		_ = PublishTwoArg(producer, translator, 1, 2)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func TestPublishTranslatorPanic(t *testing.T) {
+	eh := &collectEventHandler[order]{}
+	disruptor := NewLockfree[order](4, eh, NewChanBlockStrategy())
+	assert.NoError(t, disruptor.Start())
+	defer disruptor.Close()
+	producer := disruptor.Producer()
+
+	// 转换器panic时位置仍会被发布，不会阻塞后续的事件
+	assert.Panics(t, func() {
+		_ = PublishOneArg(producer, func(slot *order, seq uint64, id uint64) {
+			slot.id = id
+			panic("translate failed")
+		}, 1)
+	})
+	assert.NoError(t, producer.Publish(func(slot *order, seq uint64) {
+		*slot = order{id: 2, seq: seq}
+	}))
+	assert.Eventually(t, func() bool {
+		return len(eh.snapshot()) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(1), eh.snapshot()[0].id)
+	assert.Equal(t, uint64(2), eh.snapshot()[1].id)
+}
@@ -8,7 +8,8 @@
 package lockfree
 
 import (
-	"errors"
+	"fmt"
+	"math/bits"
 	"reflect"
 	"runtime"
 	"unsafe"
@@ -26,7 +27,7 @@ const (
 var (
 	ncpu        = runtime.NumCPU()
 	spin        = 0
-	ClosedError = errors.New("the queue has been closed")
+	ClosedError = ErrClosed // 兼容旧版本，推荐使用 ErrClosed
 )
 
 func init() {
@@ -35,6 +36,19 @@ func init() {
 	}
 }
 
+// configError 创建配置错误，可通过errors.Is判断是否为 ErrInvalidConfig
+func configError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidConfig, fmt.Sprintf(format, args...))
+}
+
+// panicError 将panic的内容转换为error
+func panicError(r any) error {
+	if err, ok := r.(error); ok {
+		return err
+	}
+	return fmt.Errorf("panic: %v", r)
+}
+
 //go:linkname procyield runtime.procyield
 func procyield(cycles uint32)
 
@@ -63,16 +77,33 @@ func byteArrayPointerWithInt64(capacity int) unsafe.Pointer {
 }
 
 // minSuitableCap 最小的合适的数量
+// 小于等于0时返回2，超出int范围时返回int范围内最大的2^n
 func minSuitableCap(v int) int {
 	if v <= 0 {
 		return 2
 	}
-	v--
-	v |= v >> 1
-	v |= v >> 2
-	v |= v >> 4
-	v |= v >> 8
-	v |= v >> 16
-	v++
-	return v
+	n, err := NextPowerOfTwo(v)
+	if err != nil {
+		return maxCapacity
+	}
+	return n
+}
+
+// NextPowerOfTwo 返回不小于v的最小的2^n，支持int的全部范围
+// v小于等于0或者结果超出int范围时返回 ErrInvalidConfig
+func NextPowerOfTwo(v int) (int, error) {
+	if v <= 0 {
+		return 0, configError("capacity %d must be positive", v)
+	}
+	shift := bits.Len(uint(v - 1))
+	// 最高位为符号位，2^n最大只能到2^(UintSize-2)
+	if shift > bits.UintSize-2 {
+		return 0, configError("capacity %d overflows int", v)
+	}
+	return 1 << shift, nil
+}
+
+// isPowerOfTwo 判断是否为2^n
+func isPowerOfTwo(v int) bool {
+	return v > 0 && v&(v-1) == 0
 }
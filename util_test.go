@@ -8,6 +8,9 @@
 package lockfree
 
 import (
+	"errors"
+	"math"
+	"math/bits"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,3 +28,30 @@ func TestMinSuitableCap(t *testing.T) {
 	x = minSuitableCap(16)
 	assert.Equal(t, 16, x)
 }
+
+func TestNextPowerOfTwo(t *testing.T) {
+	cases := map[int]int{
+		1:       1,
+		2:       2,
+		3:       4,
+		1023:    1024,
+		1024:    1024,
+		1 << 30: 1 << 30,
+	}
+	if bits.UintSize == 64 {
+		// 使用变量进行移位，避免32位平台编译时常量溢出
+		one := 1
+		cases[one<<32+1] = one << 33
+		cases[one<<62] = one << 62
+	}
+	for v, expected := range cases {
+		x, err := NextPowerOfTwo(v)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, x)
+	}
+	for _, v := range []int{0, -1, math.MinInt, 1<<(bits.UintSize-2) + 1, math.MaxInt} {
+		_, err := NextPowerOfTwo(v)
+		assert.True(t, errors.Is(err, ErrInvalidConfig), v)
+	}
+	assert.Equal(t, 1<<(bits.UintSize-2), minSuitableCap(math.MaxInt))
+}
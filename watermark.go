@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import "math"
+
+// Watermarks 积压水位的配置，通过 WithWatermarks 设置
+// 积压数量为已获取的写入序号与已读取序号的差值，由消费端读取事件时采样，不会在写入时增加额外的开销，
+// 因此事件处理器阻塞期间不会回调；积压数量达到高水位时回调OnHighWatermark，之后降到低水位时回调OnLowWatermark，
+// 可以用于在buffer写满前通知上游降低写入速率
+type Watermarks struct {
+	High float64 // 高水位，积压数量占容量的比例，如0.8，需要在(0, 1]范围内
+	Low  float64 // 低水位，积压数量占容量的比例，如0.2，需要在[0, High)范围内
+	// OnHighWatermark 积压数量达到高水位时的回调，由消费端的g调用，可以为nil
+	OnHighWatermark func(depth uint64)
+	// OnLowWatermark 达到高水位后积压数量降到低水位时的回调，由消费端的g调用，可以为nil
+	OnLowWatermark func(depth uint64)
+}
+
+// WithWatermarks 设置积压水位的回调，参考 Watermarks
+func WithWatermarks(w Watermarks) Option {
+	return func(o *options) {
+		o.watermarks = &w
+	}
+}
+
+// watermark 消费端的水位采样，仅由消费端的g操作
+type watermark struct {
+	w     Watermarks
+	high  uint64 // 高水位对应的积压数量
+	low   uint64 // 低水位对应的积压数量
+	every uint   // 采样间隔，即每读取该数量的事件采样一次
+	n     uint
+	above bool // 是否处于高水位（尚未降到低水位）
+}
+
+func newWatermark(w *Watermarks, capacity uint64) *watermark {
+	if w == nil {
+		return nil
+	}
+	wm := &watermark{
+		w:     *w,
+		high:  uint64(math.Ceil(w.High * float64(capacity))),
+		low:   uint64(math.Floor(w.Low * float64(capacity))),
+		every: uint(capacity / 16),
+	}
+	if wm.high < 1 {
+		wm.high = 1
+	}
+	if wm.every < 1 {
+		wm.every = 1
+	} else if wm.every > scheduleInterval {
+		wm.every = scheduleInterval
+	}
+	return wm
+}
+
+// sample 采样积压数量，rc为下一个要读取的序号，idle表示消费端暂时读取不到新的事件，此时总是采样
+func (c *consumer[T]) sample(rc uint64, idle bool) {
+	wm := c.mark
+	if wm == nil {
+		return
+	}
+	if !idle {
+		if wm.n++; wm.n < wm.every {
+			return
+		}
+	}
+	wm.n = 0
+	var depth uint64
+	if wc := c.seqer.wc.atomicLoad(); wc >= rc {
+		depth = wc - rc + 1
+	}
+	if !wm.above && depth >= wm.high {
+		wm.above = true
+		if wm.w.OnHighWatermark != nil {
+			wm.w.OnHighWatermark(depth)
+		}
+	} else if wm.above && depth <= wm.low {
+		wm.above = false
+		if wm.w.OnLowWatermark != nil {
+			wm.w.OnLowWatermark(depth)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatermarks(t *testing.T) {
+	var mu sync.Mutex
+	var highs, lows []uint64
+	h := newGateEventHandler[int]()
+	l, err := New[int](h, WithCapacity(16), WithWatermarks(Watermarks{
+		High: 0.5,
+		Low:  0.25,
+		OnHighWatermark: func(depth uint64) {
+			mu.Lock()
+			defer mu.Unlock()
+			highs = append(highs, depth)
+		},
+		OnLowWatermark: func(depth uint64) {
+			mu.Lock()
+			defer mu.Unlock()
+			lows = append(lows, depth)
+		},
+	}))
+	assert.NoError(t, err)
+	assert.NoError(t, l.Start())
+	defer l.Close()
+
+	// 第一个事件被读取后消费端阻塞，积压10个事件，超过高水位8
+	p := l.Producer()
+	assert.NoError(t, p.Write(0))
+	<-h.entered
+	for i := 1; i <= 10; i++ {
+		assert.NoError(t, p.Write(i))
+	}
+	close(h.gate)
+	assert.Eventually(t, func() bool {
+		return h.count() == 11
+	}, 5*time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 每次越过水位只回调一次
+	assert.Equal(t, []uint64{10}, highs)
+	assert.Equal(t, []uint64{4}, lows)
+}
+
+func TestWatermarksConfig(t *testing.T) {
+	cases := []Watermarks{
+		{High: 0, Low: 0},
+		{High: 1.5, Low: 0.2},
+		{High: 0.5, Low: 0.5},
+		{High: 0.5, Low: -0.1},
+	}
+	for _, w := range cases {
+		_, err := New[int](&countEventHandler[int]{}, WithWatermarks(w))
+		assert.ErrorIs(t, err, ErrInvalidConfig, "%+v", w)
+	}
+	_, err := New[int](&countEventHandler[int]{}, WithWatermarks(Watermarks{High: 1}))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	wheelTick   = time.Millisecond // 时间轮的精度
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits // 每层的槽数
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 4 // 层数，最大可覆盖 wheelTick * 64^4，约4.6小时，超出的事件会在到期前重新放入
+)
+
+// timerEntry 定时事件
+type timerEntry[T any] struct {
+	at     time.Time
+	expire uint64 // 到期的刻度
+	v      T
+}
+
+// timingWheel 分层时间轮，第k层每个槽覆盖64^k个刻度，上层的槽到期时将其中的事件重新放入下层（降级），
+// 只由消费端的g访问，不需要加锁
+type timingWheel[T any] struct {
+	start time.Time
+	now   uint64 // 当前刻度，小于该刻度的事件均已到期
+	count int
+	slots [wheelLevels][wheelSlots][]timerEntry[T]
+}
+
+func newTimingWheel[T any](start time.Time) *timingWheel[T] {
+	return &timingWheel[T]{start: start}
+}
+
+// ticks 计算时间对应的刻度
+func (w *timingWheel[T]) ticks(t time.Time) uint64 {
+	d := t.Sub(w.start)
+	if d <= 0 {
+		return 0
+	}
+	return uint64(d / wheelTick)
+}
+
+// add 加入定时事件，到期刻度向上取整，保证事件不会早于指定的时间到期，已到期的事件加入到当前刻度
+func (w *timingWheel[T]) add(e timerEntry[T]) {
+	e.expire = w.ticks(e.at.Add(wheelTick - 1))
+	if e.expire < w.now {
+		e.expire = w.now
+	}
+	w.count++
+	w.place(e)
+}
+
+// place 根据到期刻度与当前刻度的差值放入对应层的槽中
+func (w *timingWheel[T]) place(e timerEntry[T]) {
+	delta := e.expire - w.now
+	for level := 0; level < wheelLevels; level++ {
+		if delta < 1<<(wheelBits*(level+1)) {
+			i := (e.expire >> (wheelBits * level)) & wheelMask
+			w.slots[level][i] = append(w.slots[level][i], e)
+			return
+		}
+	}
+	// 超出最大范围，先放入最上层最远的槽，降级时重新计算
+	level := wheelLevels - 1
+	i := ((w.now >> (wheelBits * level)) + wheelMask) & wheelMask
+	w.slots[level][i] = append(w.slots[level][i], e)
+}
+
+// advance 推进到t，返回按照时间排序的到期事件，dst用于复用
+func (w *timingWheel[T]) advance(t time.Time, dst []timerEntry[T]) []timerEntry[T] {
+	to := w.ticks(t)
+	for w.count > 0 && w.now <= to {
+		level0 := &w.slots[0][w.now&wheelMask]
+		if len(*level0) > 0 {
+			dst = append(dst, *level0...)
+			w.count -= len(*level0)
+			clearEntries(level0)
+		}
+		w.now++
+		w.cascade()
+	}
+	if w.count == 0 && w.now <= to {
+		// 没有定时事件时直接推进
+		w.now = to + 1
+	}
+	sort.SliceStable(dst, func(i, j int) bool {
+		return dst[i].at.Before(dst[j].at)
+	})
+	return dst
+}
+
+// cascade 当前刻度跨越上层槽的边界时，将上层对应槽中的事件降级
+func (w *timingWheel[T]) cascade() {
+	for level := 1; level < wheelLevels; level++ {
+		if w.now&(1<<(wheelBits*level)-1) != 0 {
+			return
+		}
+		slot := &w.slots[level][(w.now>>(wheelBits*level))&wheelMask]
+		entries := *slot
+		*slot = nil
+		for _, e := range entries {
+			if e.expire < w.now {
+				e.expire = w.now
+			}
+			w.place(e)
+		}
+	}
+}
+
+// next 下一次需要推进的时间，即最近的非空槽的起始时间，没有定时事件时返回false
+func (w *timingWheel[T]) next() (time.Time, bool) {
+	if w.count == 0 {
+		return time.Time{}, false
+	}
+	var earliest uint64
+	found := false
+	for i := uint64(0); i < wheelSlots; i++ {
+		if t := w.now + i; len(w.slots[0][t&wheelMask]) > 0 {
+			earliest, found = t, true
+			break
+		}
+	}
+	for level := 1; level < wheelLevels; level++ {
+		shift := uint64(wheelBits * level)
+		for i := uint64(1); i <= wheelSlots; i++ {
+			b := ((w.now >> shift) + i) << shift
+			if found && b >= earliest {
+				break
+			}
+			if len(w.slots[level][(b>>shift)&wheelMask]) > 0 {
+				earliest, found = b, true
+				break
+			}
+		}
+	}
+	return w.start.Add(time.Duration(earliest) * wheelTick), true
+}
+
+// clearEntries 清空槽并保留底层数组，清理引用防止事件无法被回收
+func clearEntries[T any](slot *[]timerEntry[T]) {
+	var zero timerEntry[T]
+	s := *slot
+	for i := range s {
+		s[i] = zero
+	}
+	*slot = s[:0]
+}
+
+// scheduler 定时写入的调度器，生产者写入收件箱，消费端将收件箱中的事件放入时间轮并推进
+type scheduler[T any] struct {
+	mu      sync.Mutex
+	inbox   []timerEntry[T]
+	pending int32 // 收件箱中的事件数量
+	wheel   *timingWheel[T]
+	expired []timerEntry[T]
+	release func() // 唤醒消费端
+}
+
+func newScheduler[T any]() *scheduler[T] {
+	return &scheduler[T]{
+		wheel: newTimingWheel[T](time.Now()),
+	}
+}
+
+// add 由生产者调用，加入定时事件后唤醒消费端
+func (s *scheduler[T]) add(v T, at time.Time) {
+	s.mu.Lock()
+	s.inbox = append(s.inbox, timerEntry[T]{at: at, v: v})
+	s.mu.Unlock()
+	atomic.AddInt32(&s.pending, 1)
+	s.release()
+}
+
+// ready 收件箱中是否有需要消费端处理的事件，用于消费端阻塞的判断
+func (s *scheduler[T]) ready() bool {
+	return atomic.LoadInt32(&s.pending) > 0
+}
+
+// poll 由消费端调用，将收件箱中的事件放入时间轮并推进，返回到期的事件，返回的切片在下次调用前有效
+func (s *scheduler[T]) poll() []timerEntry[T] {
+	if atomic.LoadInt32(&s.pending) == 0 && s.wheel.count == 0 {
+		return nil
+	}
+	if atomic.LoadInt32(&s.pending) > 0 {
+		s.mu.Lock()
+		inbox := s.inbox
+		s.inbox = nil
+		atomic.StoreInt32(&s.pending, 0)
+		s.mu.Unlock()
+		for _, e := range inbox {
+			s.wheel.add(e)
+		}
+	}
+	for i := range s.expired {
+		s.expired[i] = timerEntry[T]{}
+	}
+	s.expired = s.wheel.advance(time.Now(), s.expired[:0])
+	return s.expired
+}
+
+// next 时间轮中最近需要推进的时间，没有定时事件时返回false
+func (s *scheduler[T]) next() (time.Time, bool) {
+	return s.wheel.next()
+}
+
+// alarm 消费端的定时唤醒，消费端阻塞前按照最近的截止时间设置，到期后唤醒消费端
+// 除fired外只由消费端的g访问
+type alarm struct {
+	timer    *time.Timer
+	deadline time.Time
+	fired    int32 // 定时器已触发，消费端需要重新判断
+	release  func()
+}
+
+// reset 清除已触发的状态，由消费端在阻塞前调用，此时触发的唤醒已被处理，否则消费端不会再阻塞
+func (a *alarm) reset() {
+	if atomic.LoadInt32(&a.fired) > 0 {
+		// 定时器已触发，需要重新设置
+		atomic.StoreInt32(&a.fired, 0)
+		a.deadline = time.Time{}
+	}
+}
+
+// set 设置唤醒时间，已设置为该时间时不重复设置
+func (a *alarm) set(t time.Time) {
+	a.reset()
+	if t.Equal(a.deadline) {
+		return
+	}
+	a.deadline = t
+	d := time.Until(t)
+	if a.timer == nil {
+		a.timer = time.AfterFunc(d, a.fire)
+		return
+	}
+	a.timer.Stop()
+	a.timer.Reset(d)
+}
+
+// ready 定时器是否已触发，用于消费端阻塞的判断
+func (a *alarm) ready() bool {
+	return atomic.LoadInt32(&a.fired) > 0
+}
+
+func (a *alarm) fire() {
+	atomic.StoreInt32(&a.fired, 1)
+	a.release()
+}
+
+// stop 由消费端在退出时调用
+func (a *alarm) stop() {
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.deadline = time.Time{}
+}
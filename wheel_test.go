@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) THL A29 Limited, a Tencent company. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ */
+
+package lockfree
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimingWheel(t *testing.T) {
+	start := time.Now()
+	w := newTimingWheel[int](start)
+	delays := []time.Duration{
+		0, 500 * time.Microsecond, 3 * time.Millisecond, 70 * time.Millisecond, 5 * time.Second,
+		2 * time.Hour, 10 * time.Hour, 63 * time.Millisecond, 64 * time.Millisecond, 4096 * time.Millisecond,
+	}
+	for i, d := range delays {
+		w.add(timerEntry[int]{at: start.Add(d), v: i})
+	}
+	var got []int
+	var expired []timerEntry[int]
+	// 按照时间轮给出的下一次推进时间逐步推进，模拟消费端
+	for now := start; len(got) < len(delays); {
+		next, ok := w.next()
+		assert.True(t, ok)
+		if next.After(now) {
+			now = next
+		}
+		expired = w.advance(now, expired[:0])
+		for _, e := range expired {
+			// 不会早于指定的时间到期，且延迟不超过一个刻度
+			assert.False(t, now.Before(e.at), e.v)
+			assert.Less(t, now.Sub(e.at), wheelTick, e.v)
+			got = append(got, e.v)
+		}
+	}
+	assert.Equal(t, []int{0, 1, 2, 7, 8, 3, 9, 4, 5, 6}, got)
+	_, ok := w.next()
+	assert.False(t, ok)
+}
+
+func TestWriteAfter(t *testing.T) {
+	for _, blocks := range []blockStrategy{NewChanBlockStrategy(), NewConditionBlockStrategy(), NewSleepBlockStrategy(time.Millisecond)} {
+		h := &collectEventHandler[int]{}
+		lf := NewLockfree[int](16, h, blocks)
+		assert.NoError(t, lf.Start())
+		producer := lf.Producer()
+		now := time.Now()
+		delays := map[int]time.Duration{1: 60 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond}
+		for v, d := range delays {
+			assert.NoError(t, producer.WriteAt(v, now.Add(d)))
+		}
+		// 已经过去的时间会尽快处理
+		assert.NoError(t, producer.WriteAfter(0, -time.Second))
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, producer.Write(100+i))
+		}
+		assert.Eventually(t, func() bool { return h.count() == 14 }, time.Second, time.Millisecond)
+		var scheduled []int
+		seqs, times := h.sequences(), h.timestamps()
+		for i, v := range h.snapshot() {
+			if v >= 100 {
+				assert.Equal(t, uint64(v-99), seqs[i])
+				continue
+			}
+			scheduled = append(scheduled, v)
+			assert.Equal(t, uint64(0), seqs[i])
+			assert.False(t, times[i].Before(now.Add(delays[v])), v)
+		}
+		assert.Equal(t, []int{0, 2, 3, 1}, scheduled)
+		assert.NoError(t, lf.Close())
+		assert.ErrorIs(t, producer.WriteAfter(1, time.Millisecond), ClosedError)
+	}
+}
+
+func TestWriteAfterParks(t *testing.T) {
+	h := &collectEventHandler[int]{}
+	lf, err := New[int](h)
+	assert.NoError(t, err)
+	assert.NoError(t, lf.Start())
+	defer lf.Close()
+
+	assert.NoError(t, lf.Producer().WriteAfter(1, time.Millisecond))
+	assert.Eventually(t, func() bool { return h.count() == 1 }, time.Second, time.Millisecond)
+	// 定时事件处理完成后消费端需要重新阻塞，而不是因为已触发的唤醒一直自旋
+	blocks := lf.consumer.blocks.(*sharedBlockStrategy)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&blocks.waiters) == 1
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&blocks.waiters))
+	assert.False(t, lf.consumer.wake.ready())
+}